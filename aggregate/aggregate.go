@@ -0,0 +1,148 @@
+// Package aggregate merges the results of all arrays, adds up the client
+// rollups and compares a run with the previous one.
+package aggregate
+
+import (
+	"strings"
+
+	"dataCollection/model"
+)
+
+// Merge joins the pools and systems of all arrays, a stale pool is only
+// added when the array did not report the same pool id this run
+func Merge(results []model.ArrayResult) (output model.Pools, systems []model.System) {
+	for _, res := range results {
+		output.Pools = append(output.Pools, res.Pools.Pools...)
+		fresh := make(map[string]bool)
+		for _, pool := range res.Pools.Pools {
+			fresh[pool.Id] = true
+		}
+		for _, pool := range res.StalePools.Pools {
+			if !fresh[pool.Id] {
+				output.Pools = append(output.Pools, pool)
+			}
+		}
+		if res.System.Vendor != "" {
+			systems = append(systems, res.System)
+		}
+	}
+	return output, systems
+}
+
+// ClientRollup adds up the capacity of all pools belonging to a client
+func ClientRollup(name string, pools model.Pools) (output model.Client) {
+	output.Name = name
+	for _, s := range pools.Pools {
+		if s.Client == name {
+			output.Total += s.PoolCapacity
+			output.TotalFree += s.PoolCapacityFree
+			if !model.IsHealthy(s) {
+				output.UnhealthyPools++
+				output.UnhealthyCapacity += s.PoolCapacity
+			}
+			if s.Site == "P16" {
+				output.P16Total += s.PoolCapacity
+				output.P16Free += s.PoolCapacityFree
+				if strings.Contains(s.Type, "Internal") {
+					output.P16InternalTotal += s.PoolCapacity
+					output.P16InternalFree += s.PoolCapacityFree
+					if strings.Contains(s.Type, "SSD") || strings.Contains(s.Type, "MIX") {
+						output.P16InternalSSDTotal += s.PoolCapacity
+						output.P16InternalSSDFree += s.PoolCapacityFree
+						output.P16InternalSSDMinLun += int(s.PoolCapacityFree / 10000000000000)
+					} else if strings.Contains(s.Type, "SAS") {
+						output.P16InternalHDDTotal += s.PoolCapacity
+						output.P16InternalHDDFree += s.PoolCapacityFree
+						output.P16InternalHDDMinLun += int(s.PoolCapacityFree / 10000000000000)
+					}
+				} else if strings.Contains(s.Type, "Shared") {
+					output.P16ExternalTotal += s.PoolCapacity
+					output.P16ExternalFree += s.PoolCapacityFree
+					if strings.Contains(s.Type, "SSD") || strings.Contains(s.Type, "MIX") {
+						output.P16ExternalSSDTotal += s.PoolCapacity
+						output.P16ExternalSSDFree += s.PoolCapacityFree
+						output.P16ExternalSSDMinLun += int(s.PoolCapacityFree / 10000000000000)
+					} else if strings.Contains(s.Type, "SAS") {
+						output.P16ExternalHDDTotal += s.PoolCapacity
+						output.P16ExternalHDDFree += s.PoolCapacityFree
+						output.P16ExternalHDDMinLun += int(s.PoolCapacityFree / 10000000000000)
+					}
+				}
+			} else if s.Site == "Z141" {
+				output.Z141Total += s.PoolCapacity
+				output.Z141Free += s.PoolCapacityFree
+				if strings.Contains(s.Type, "Internal") {
+					output.Z141InternalTotal += s.PoolCapacity
+					output.Z141InternalFree += s.PoolCapacityFree
+					if strings.Contains(s.Type, "SSD") || strings.Contains(s.Type, "MIX") {
+						output.Z141InternalSSDTotal += s.PoolCapacity
+						output.Z141InternalSSDFree += s.PoolCapacityFree
+						output.Z141InternalSSDMinLun += int(s.PoolCapacityFree / 10000000000000)
+					} else if strings.Contains(s.Type, "SAS") {
+						output.Z141InternalHDDTotal += s.PoolCapacity
+						output.Z141InternalHDDFree += s.PoolCapacityFree
+						output.Z141InternalHDDMinLun += int(s.PoolCapacityFree / 10000000000000)
+					}
+				} else if strings.Contains(s.Type, "Shared") {
+					output.Z141ExternalTotal += s.PoolCapacity
+					output.Z141ExternalFree += s.PoolCapacityFree
+					if strings.Contains(s.Type, "SSD") || strings.Contains(s.Type, "MIX") {
+						output.Z141ExternalSSDTotal += s.PoolCapacity
+						output.Z141ExternalSSDFree += s.PoolCapacityFree
+						output.Z141ExternalSSDMinLun += int(s.PoolCapacityFree / 10000000000000)
+					} else if strings.Contains(s.Type, "SAS") {
+						output.Z141ExternalHDDTotal += s.PoolCapacity
+						output.Z141ExternalHDDFree += s.PoolCapacityFree
+						output.Z141ExternalHDDMinLun += int(s.PoolCapacityFree / 10000000000000)
+					}
+				}
+			} else if s.Site == "Stretched" {
+
+				if strings.Contains(s.PoolName, "P16") {
+					output.P16Total += s.PoolCapacity
+					output.P16Free += s.PoolCapacityFree
+					output.StretchedP16Total += s.PoolCapacity
+					output.StretchedP16Free += s.PoolCapacityFree
+					output.StretchedP16MinLun += int(s.PoolCapacityFree / 10000000000000)
+
+				} else if strings.Contains(s.PoolName, "Z141") {
+					output.Z141Total += s.PoolCapacity
+					output.Z141Free += s.PoolCapacityFree
+					output.StretchedZ141Total += s.PoolCapacity
+					output.StretchedZ141Free += s.PoolCapacityFree
+					output.StretchedZ141MinLun += int(s.PoolCapacityFree / 10000000000000)
+				}
+
+			}
+
+		}
+	}
+	return output
+}
+
+// ClientNames returns the distinct clients of the arrays in the order they were seen
+func ClientNames(results []model.ArrayResult) (names []string) {
+	seen := make(map[string]bool)
+	for _, res := range results {
+		if !seen[res.Array.Client] {
+			seen[res.Array.Client] = true
+			names = append(names, res.Array.Client)
+		}
+	}
+	return names
+}
+
+// ApplyCoverage counts per client how many arrays are expected and how many reported
+func ApplyCoverage(clients []model.Client, results []model.ArrayResult) {
+	for i := range clients {
+		for _, res := range results {
+			if res.Array.Client != clients[i].Name {
+				continue
+			}
+			clients[i].ArraysExpected++
+			if res.Err == nil {
+				clients[i].ArraysReporting++
+			}
+		}
+	}
+}
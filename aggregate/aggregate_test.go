@@ -0,0 +1,77 @@
+package aggregate
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"dataCollection/model"
+)
+
+func TestMerge(t *testing.T) {
+	stale := func(ids ...string) model.Pools {
+		output := model.Pools{Pools: pools("A", ids...)}
+		for i := range output.Pools {
+			output.Pools[i].Stale = true
+		}
+		return output
+	}
+	tests := []struct {
+		name   string
+		result model.ArrayResult
+		want   []string
+	}{
+		{name: "fresh only", result: model.ArrayResult{Pools: model.Pools{Pools: pools("A", "0", "1")}}, want: []string{"0", "1"}},
+		{name: "stale only", result: model.ArrayResult{StalePools: stale("0", "1")}, want: []string{"0", "1"}},
+		{name: "fresh wins over stale", result: model.ArrayResult{Pools: model.Pools{Pools: pools("A", "0")}, StalePools: stale("0", "1")}, want: []string{"0", "1"}},
+		{name: "nothing", result: model.ArrayResult{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			merged, _ := Merge([]model.ArrayResult{test.result})
+			if len(merged.Pools) != len(test.want) {
+				t.Fatalf("%d pools, want %d", len(merged.Pools), len(test.want))
+			}
+			for i, pool := range merged.Pools {
+				if pool.Id != test.want[i] {
+					t.Errorf("pool %d is %s, want %s", i, pool.Id, test.want[i])
+				}
+			}
+			if test.name == "fresh wins over stale" && merged.Pools[0].Stale {
+				t.Error("pool 0 is the stale copy")
+			}
+		})
+	}
+}
+
+func TestApplyCoverage(t *testing.T) {
+	failed := errors.New("dial tcp: connection refused")
+	z141 := pools("C", "0")
+	z141[0].Client = "Z141"
+	results := []model.ArrayResult{
+		{Array: model.Array{Name: "A", Client: "P16"}, Pools: model.Pools{Pools: pools("A", "0")}},
+		{Array: model.Array{Name: "B", Client: "P16"}, Err: failed},
+		{Array: model.Array{Name: "C", Client: "Z141"}, Pools: model.Pools{Pools: z141}},
+	}
+	// D was collected ten minutes ago by another schedule, its pools count but it did not report
+	results = append(results, StateResults([]model.Array{{Name: "D", Client: "P16"}}, map[string]ArrayState{"D": {Time: now.Add(-10 * time.Minute), Pools: pools("D", "0")}}, time.Hour, now)...)
+
+	merged, _ := Merge(results)
+	var clients []model.Client
+	for _, name := range ClientNames(results) {
+		clients = append(clients, ClientRollup(name, merged))
+	}
+	ApplyCoverage(clients, results)
+	if len(clients) != 2 || clients[0].Name != "P16" {
+		t.Fatalf("clients %+v", clients)
+	}
+	if clients[0].ArraysExpected != 3 || clients[0].ArraysReporting != 1 {
+		t.Errorf("P16 %d of %d arrays reporting, want 1 of 3", clients[0].ArraysReporting, clients[0].ArraysExpected)
+	}
+	if clients[0].Total != 200 {
+		t.Errorf("P16 total %v, want the pools of A and D", clients[0].Total)
+	}
+	if clients[1].Coverage() != 1 {
+		t.Errorf("Z141 coverage %v, want 1", clients[1].Coverage())
+	}
+}
@@ -0,0 +1,109 @@
+package aggregate
+
+import (
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"dataCollection/model"
+)
+
+// DetectChanges compares the pools and firmware of every collected array with the
+// last known good state, keyed by array and pool id. Arrays that failed or have
+// no state yet are skipped so an outage does not look like deleted pools
+func DetectChanges(state map[string]ArrayState, results []model.ArrayResult, now time.Time) []model.ChangeEvent {
+	var events []model.ChangeEvent
+	for _, res := range results {
+		if res.Err != nil {
+			continue
+		}
+		last, ok := state[res.Array.Name]
+		if !ok {
+			continue
+		}
+		event := func(kind string, pool model.Pool) model.ChangeEvent {
+			return model.ChangeEvent{Time: now, Kind: kind, Array: res.Array.Name, Site: res.Array.Site, Client: res.Array.Client, PoolId: pool.Id, PoolName: pool.PoolName}
+		}
+
+		before := make(map[string]model.Pool)
+		for _, pool := range last.Pools {
+			before[pool.Id] = pool
+		}
+		seen := make(map[string]bool)
+		for _, pool := range res.Pools.Pools {
+			seen[pool.Id] = true
+			old, ok := before[pool.Id]
+			if !ok {
+				e := event(model.EventPoolAdded, pool)
+				e.To = model.Terabytes(pool.PoolCapacity) + " TB"
+				e.Delta = pool.PoolCapacity
+				events = append(events, e)
+				continue
+			}
+			if old.PoolName != pool.PoolName {
+				e := event(model.EventPoolRenamed, pool)
+				e.From = old.PoolName
+				e.To = pool.PoolName
+				events = append(events, e)
+			}
+			if old.PoolCapacity != pool.PoolCapacity {
+				kind := model.EventPoolExpanded
+				if pool.PoolCapacity < old.PoolCapacity {
+					kind = model.EventPoolShrunk
+				}
+				e := event(kind, pool)
+				e.From = model.Terabytes(old.PoolCapacity) + " TB"
+				e.To = model.Terabytes(pool.PoolCapacity) + " TB"
+				e.Delta = pool.PoolCapacity - old.PoolCapacity
+				events = append(events, e)
+			}
+		}
+		for _, pool := range last.Pools {
+			if !seen[pool.Id] {
+				e := event(model.EventPoolRemoved, pool)
+				e.From = model.Terabytes(pool.PoolCapacity) + " TB"
+				e.Delta = -pool.PoolCapacity
+				events = append(events, e)
+			}
+		}
+
+		from := firmwareOf(last.System, last.Pools)
+		to := firmwareOf(res.System, res.Pools.Pools)
+		if from != "" && to != "" && from != to {
+			e := event(model.EventFirmwareChange, model.Pool{})
+			e.From = from
+			e.To = to
+			events = append(events, e)
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Array < events[j].Array
+	})
+	return events
+}
+
+// firmwareOf prefers the system record and falls back to the firmware string of
+// the pools for state written before it existed. Pools of Huawei arrays carry
+// "version, patch", both are brought to "version patch" so they compare equal
+func firmwareOf(system model.System, pools []model.Pool) string {
+	if system.Firmware != "" {
+		return normalizeFirmware(system.Firmware + " " + system.Patch)
+	}
+	for _, pool := range pools {
+		if pool.Firmware != "" {
+			return normalizeFirmware(pool.Firmware)
+		}
+	}
+	return ""
+}
+
+func normalizeFirmware(firmware string) string {
+	return strings.Join(strings.Fields(strings.ReplaceAll(firmware, ",", " ")), " ")
+}
+
+func LogChanges(events []model.ChangeEvent) {
+	for _, e := range events {
+		slog.Info("inventory change", "array", e.Array, "phase", "changes", "kind", e.Kind, "pool", e.PoolName, "from", e.From, "to", e.To)
+	}
+}
@@ -0,0 +1,97 @@
+package aggregate
+
+import (
+	"errors"
+	"testing"
+
+	"dataCollection/model"
+)
+
+func TestDetectChanges(t *testing.T) {
+	pool := func(id, name string, capacity float64) model.Pool {
+		return model.Pool{ArrayName: "A", Id: id, PoolName: name, PoolCapacity: capacity, Firmware: "V300R006C20, SPH105"}
+	}
+	system := model.System{Vendor: "Huawei", Firmware: "V300R006C20", Patch: "SPH105"}
+	last := ArrayState{Pools: []model.Pool{pool("0", "P16_SSD01", 100), pool("1", "P16_SSD02", 100)}, System: system}
+	tests := []struct {
+		name   string
+		state  map[string]ArrayState
+		result model.ArrayResult
+		want   []string
+	}{
+		{
+			name:   "unchanged",
+			state:  map[string]ArrayState{"A": last},
+			result: model.ArrayResult{Pools: model.Pools{Pools: []model.Pool{pool("0", "P16_SSD01", 100), pool("1", "P16_SSD02", 100)}}, System: system},
+		},
+		{
+			name:   "added, removed, expanded and renamed",
+			state:  map[string]ArrayState{"A": last},
+			result: model.ArrayResult{Pools: model.Pools{Pools: []model.Pool{pool("0", "P16_SSD01_NEW", 200), pool("2", "P16_SSD03", 50)}}, System: system},
+			want:   []string{model.EventPoolRenamed, model.EventPoolExpanded, model.EventPoolAdded, model.EventPoolRemoved},
+		},
+		{
+			name:   "shrunk",
+			state:  map[string]ArrayState{"A": last},
+			result: model.ArrayResult{Pools: model.Pools{Pools: []model.Pool{pool("0", "P16_SSD01", 50), pool("1", "P16_SSD02", 100)}}, System: system},
+			want:   []string{model.EventPoolShrunk},
+		},
+		{
+			name:   "firmware upgrade",
+			state:  map[string]ArrayState{"A": last},
+			result: model.ArrayResult{Pools: model.Pools{Pools: last.Pools}, System: model.System{Vendor: "Huawei", Firmware: "V300R006C30", Patch: "SPH105"}},
+			want:   []string{model.EventFirmwareChange},
+		},
+		{
+			name:   "state written before the system record",
+			state:  map[string]ArrayState{"A": {Pools: last.Pools}},
+			result: model.ArrayResult{Pools: model.Pools{Pools: last.Pools}, System: system},
+		},
+		{
+			name:   "failed array",
+			state:  map[string]ArrayState{"A": last},
+			result: model.ArrayResult{Err: errors.New("dial tcp: connection refused")},
+		},
+		{
+			name:   "no state yet",
+			result: model.ArrayResult{Pools: model.Pools{Pools: last.Pools}, System: system},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.result.Array = model.Array{Name: "A", Site: "P16", Client: "P16"}
+			events := DetectChanges(test.state, []model.ArrayResult{test.result}, now)
+			if len(events) != len(test.want) {
+				t.Fatalf("events %+v, want %v", events, test.want)
+			}
+			for i, event := range events {
+				if event.Kind != test.want[i] || event.Array != "A" || !event.Time.Equal(now) {
+					t.Errorf("event %d is %+v, want %s", i, event, test.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestFirmwareOf(t *testing.T) {
+	tests := []struct {
+		name   string
+		system model.System
+		pools  []model.Pool
+		want   string
+	}{
+		{name: "system with patch", system: model.System{Firmware: "V300R006C20", Patch: "SPH105"}, want: "V300R006C20 SPH105"},
+		{name: "system without patch", system: model.System{Firmware: "8.3.1.5"}, want: "8.3.1.5"},
+		{name: "huawei pools of old state", pools: []model.Pool{{Firmware: "V300R006C20, SPH105"}}, want: "V300R006C20 SPH105"},
+		{name: "huawei pools without patch", pools: []model.Pool{{Firmware: "V300R006C20, "}}, want: "V300R006C20"},
+		{name: "ibm pools of old state", pools: []model.Pool{{Firmware: "8.3.1.5"}}, want: "8.3.1.5"},
+		{name: "nothing known"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := firmwareOf(test.system, test.pools); got != test.want {
+				t.Errorf("firmwareOf = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package aggregate
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"time"
+
+	"dataCollection/model"
+)
+
+// ArrayState is the last known good collection of an array
+type ArrayState struct {
+	Time   time.Time    `json:"time"`
+	Pools  []model.Pool `json:"pools"`
+	System model.System `json:"system"`
+}
+
+func LoadState(filename string) (map[string]ArrayState, error) {
+	state := make(map[string]ArrayState)
+	byteValue, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return state, err
+	}
+	err = json.Unmarshal(byteValue, &state)
+	return state, err
+}
+
+func SaveState(filename string, state map[string]ArrayState) error {
+	byteValue, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	temp := filename + ".tmp"
+	if err := ioutil.WriteFile(temp, byteValue, 0644); err != nil {
+		return err
+	}
+	return os.Rename(temp, filename)
+}
+
+// CarryForward remembers the pools of arrays that were collected and gives
+// arrays that failed without parsing any pool their last known good pools,
+// flagged as stale, as long as they are not older than maxAge. An array that
+// failed after parsing some pools keeps those, carrying forward the others
+// would count a pool twice or mix old and new pools of one array
+func CarryForward(results []model.ArrayResult, state map[string]ArrayState, maxAge time.Duration, now time.Time) {
+	for i := range results {
+		res := &results[i]
+		if res.Err == nil {
+			state[res.Array.Name] = ArrayState{Time: res.Started, Pools: res.Pools.Pools, System: res.System}
+			continue
+		}
+		last, ok := state[res.Array.Name]
+		if !ok || len(res.Pools.Pools) > 0 {
+			continue
+		}
+		age := now.Sub(last.Time)
+		if age > maxAge {
+			slog.Warn("last known good data too old to carry forward", "array", res.Array.Name, "phase", "stale", "age", age.String())
+			continue
+		}
+		for _, pool := range last.Pools {
+			pool.Stale = true
+			pool.StaleSeconds = age.Seconds()
+			res.StalePools.Pools = append(res.StalePools.Pools, pool)
+		}
+		slog.Info("carrying forward last known good pools", "array", res.Array.Name, "phase", "stale", "pools", len(last.Pools), "age", age.String())
+	}
+}
+
+// ErrNotCollected is the error of an array that was not collected in this run
+var ErrNotCollected = errors.New("not collected this run")
+
+// StateResults gives arrays that were not collected in this run a result with their
+// last known good pools flagged as stale, so the client rollups of a run that collected
+// only some of the arrays still add up all of them. They all fail with ErrNotCollected
+// so coverage only counts the arrays that reported in this run
+func StateResults(arrays []model.Array, state map[string]ArrayState, maxAge time.Duration, now time.Time) []model.ArrayResult {
+	var results []model.ArrayResult
+	for _, array := range arrays {
+		res := model.ArrayResult{Array: array, Err: ErrNotCollected}
+		if last, ok := state[array.Name]; ok && now.Sub(last.Time) <= maxAge {
+			age := now.Sub(last.Time)
+			for _, pool := range last.Pools {
+				pool.Stale = true
+				pool.StaleSeconds = age.Seconds()
+				res.StalePools.Pools = append(res.StalePools.Pools, pool)
+			}
+			res.Started = last.Time
+		}
+		results = append(results, res)
+	}
+	return results
+}
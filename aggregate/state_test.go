@@ -0,0 +1,106 @@
+package aggregate
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"dataCollection/model"
+)
+
+var now = time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+func pools(array string, ids ...string) []model.Pool {
+	var output []model.Pool
+	for _, id := range ids {
+		output = append(output, model.Pool{ArrayName: array, Id: id, Client: "P16", PoolCapacity: 100, PoolCapacityFree: 40})
+	}
+	return output
+}
+
+func TestCarryForward(t *testing.T) {
+	failed := errors.New("dial tcp: connection refused")
+	tests := []struct {
+		name      string
+		result    model.ArrayResult
+		state     map[string]ArrayState
+		stale     int
+		stateKeys int
+	}{
+		{
+			name:      "success is remembered",
+			result:    model.ArrayResult{Array: model.Array{Name: "A"}, Pools: model.Pools{Pools: pools("A", "0", "1")}, Started: now},
+			stateKeys: 1,
+		},
+		{
+			name:      "failure without pools carries forward",
+			result:    model.ArrayResult{Array: model.Array{Name: "A"}, Err: failed},
+			state:     map[string]ArrayState{"A": {Time: now.Add(-time.Hour), Pools: pools("A", "0", "1")}},
+			stale:     2,
+			stateKeys: 1,
+		},
+		{
+			name:      "failure with some pools carries nothing forward",
+			result:    model.ArrayResult{Array: model.Array{Name: "A"}, Pools: model.Pools{Pools: pools("A", "0")}, Err: failed},
+			state:     map[string]ArrayState{"A": {Time: now.Add(-time.Hour), Pools: pools("A", "0", "1")}},
+			stateKeys: 1,
+		},
+		{
+			name:      "state too old",
+			result:    model.ArrayResult{Array: model.Array{Name: "A"}, Err: failed},
+			state:     map[string]ArrayState{"A": {Time: now.Add(-48 * time.Hour), Pools: pools("A", "0", "1")}},
+			stateKeys: 1,
+		},
+		{
+			name:   "failure without state",
+			result: model.ArrayResult{Array: model.Array{Name: "A"}, Err: failed},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			state := test.state
+			if state == nil {
+				state = make(map[string]ArrayState)
+			}
+			results := []model.ArrayResult{test.result}
+			CarryForward(results, state, 24*time.Hour, now)
+			if len(results[0].StalePools.Pools) != test.stale {
+				t.Errorf("%d stale pools, want %d", len(results[0].StalePools.Pools), test.stale)
+			}
+			for _, pool := range results[0].StalePools.Pools {
+				if !pool.Stale || pool.StaleSeconds != 3600 {
+					t.Errorf("stale pool %+v, want flagged an hour old", pool)
+				}
+			}
+			if len(state) != test.stateKeys {
+				t.Errorf("%d arrays in state, want %d", len(state), test.stateKeys)
+			}
+		})
+	}
+}
+
+func TestStateResults(t *testing.T) {
+	arrays := []model.Array{{Name: "A", Client: "P16"}, {Name: "B", Client: "P16"}, {Name: "C", Client: "P16"}}
+	state := map[string]ArrayState{
+		"A": {Time: now.Add(-10 * time.Minute), Pools: pools("A", "0", "1")},
+		"B": {Time: now.Add(-48 * time.Hour), Pools: pools("B", "0")},
+	}
+	results := StateResults(arrays, state, 24*time.Hour, now)
+	if len(results) != 3 {
+		t.Fatalf("%d results, want 3", len(results))
+	}
+	for _, res := range results {
+		if !errors.Is(res.Err, ErrNotCollected) {
+			t.Errorf("%s has error %v, want ErrNotCollected", res.Array.Name, res.Err)
+		}
+		if len(res.Pools.Pools) != 0 {
+			t.Errorf("%s has fresh pools", res.Array.Name)
+		}
+	}
+	if len(results[0].StalePools.Pools) != 2 || !results[0].StalePools.Pools[0].Stale || results[0].StalePools.Pools[0].StaleSeconds != 600 {
+		t.Errorf("A has stale pools %+v, want both ten minutes old", results[0].StalePools.Pools)
+	}
+	if len(results[1].StalePools.Pools) != 0 || len(results[2].StalePools.Pools) != 0 {
+		t.Error("pools of B or C without recent state")
+	}
+}
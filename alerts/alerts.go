@@ -0,0 +1,319 @@
+// Package alerts notifies when pools cross the thresholds of the alerts file.
+package alerts
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"dataCollection/model"
+)
+
+// AlertConfig struct which contains the thresholds
+// and the notification sinks read from alerts.json
+type AlertConfig struct {
+	Thresholds      []Threshold `json:"thresholds"`
+	UseArrayWarning bool        `json:"use_array_warning"`
+	Webhook         string      `json:"webhook"`
+	SMTP            SMTPConfig  `json:"smtp"`
+	File            string      `json:"file"`
+	StateFile       string      `json:"state_file"`
+	Renotify        string      `json:"renotify"`
+}
+
+// Threshold struct which contains warning and critical
+// levels in percent, empty client, site or type match everything
+type Threshold struct {
+	Client   string  `json:"client"`
+	Site     string  `json:"site"`
+	Type     string  `json:"type"`
+	Warning  float64 `json:"warning"`
+	Critical float64 `json:"critical"`
+}
+
+type SMTPConfig struct {
+	Host     string   `json:"host"`
+	Port     int      `json:"port"`
+	Username string   `json:"username"`
+	Password string   `json:"password"`
+	From     string   `json:"from"`
+	To       []string `json:"to"`
+}
+
+type Alert struct {
+	ArrayName string    `json:"array"`
+	PoolId    string    `json:"pool_id"`
+	PoolName  string    `json:"pool"`
+	Client    string    `json:"client"`
+	Site      string    `json:"site"`
+	Type      string    `json:"type"`
+	Level     string    `json:"level"`
+	UsedPCT   float64   `json:"used_pct"`
+	Threshold float64   `json:"threshold"`
+	Reason    string    `json:"reason"`
+	Time      time.Time `json:"time"`
+}
+
+// alertState is what is remembered between runs for every pool in breach
+type alertState struct {
+	Level        string    `json:"level"`
+	Since        time.Time `json:"since"`
+	LastNotified time.Time `json:"last_notified"`
+}
+
+type notifier interface {
+	notify(alerts []Alert) error
+}
+
+func readAlertConfig(filename string) (config AlertConfig, err error) {
+	byteValue, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return config, err
+	}
+	err = json.Unmarshal(byteValue, &config)
+	if config.StateFile == "" {
+		config.StateFile = "alerts_state.json"
+	}
+	return config, err
+}
+
+// matchThreshold returns the most specific threshold matching the pool
+func matchThreshold(thresholds []Threshold, pool model.Pool) (Threshold, bool) {
+	var match Threshold
+	found := false
+	best := -1
+	for _, threshold := range thresholds {
+		if threshold.Client != "" && threshold.Client != pool.Client {
+			continue
+		}
+		if threshold.Site != "" && threshold.Site != pool.Site {
+			continue
+		}
+		if threshold.Type != "" && !strings.Contains(pool.Type, threshold.Type) {
+			continue
+		}
+		specific := 0
+		for _, field := range []string{threshold.Client, threshold.Site, threshold.Type} {
+			if field != "" {
+				specific++
+			}
+		}
+		if specific > best {
+			best = specific
+			match = threshold
+			found = true
+		}
+	}
+	return match, found
+}
+
+// evaluatePool returns the alert level of a pool, or "ok" when nothing is breached
+func evaluatePool(config AlertConfig, pool model.Pool, now time.Time) Alert {
+	alert := Alert{
+		ArrayName: pool.ArrayName,
+		PoolId:    pool.Id,
+		PoolName:  pool.PoolName,
+		Client:    pool.Client,
+		Site:      pool.Site,
+		Type:      pool.Type,
+		Level:     "ok",
+		UsedPCT:   pool.PoolCapacityPCT * 100,
+		Time:      now,
+	}
+	threshold, found := matchThreshold(config.Thresholds, pool)
+	if found && threshold.Critical > 0 && alert.UsedPCT >= threshold.Critical {
+		alert.Level = "critical"
+		alert.Threshold = threshold.Critical
+		alert.Reason = "critical threshold"
+	} else if found && threshold.Warning > 0 && alert.UsedPCT >= threshold.Warning {
+		alert.Level = "warning"
+		alert.Threshold = threshold.Warning
+		alert.Reason = "warning threshold"
+	} else if config.UseArrayWarning && pool.WarningPCT > 0 && alert.UsedPCT >= pool.WarningPCT {
+		alert.Level = "warning"
+		alert.Threshold = pool.WarningPCT
+		alert.Reason = "array warning level"
+	}
+	return alert
+}
+
+// Check evaluates every pool and notifies the sinks about alerts that are new, changed
+// level, cleared or due for a reminder. The state is only written once every sink took
+// the alerts, so an alert that could not be sent is sent again by the next run
+func Check(pools model.Pools, configFile string) error {
+	config, err := readAlertConfig(configFile)
+	if err != nil {
+		return err
+	}
+	renotify := 24 * time.Hour
+	if config.Renotify != "" {
+		renotify, err = time.ParseDuration(config.Renotify)
+		if err != nil {
+			return err
+		}
+	}
+	state, err := readState(config.StateFile)
+	if err != nil {
+		return err
+	}
+	alerts := evaluate(config, renotify, pools, state, time.Now())
+	if len(alerts) > 0 {
+		if err := notifyAll(config.notifiers(), alerts); err != nil {
+			return err
+		}
+	}
+	byteValue, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(config.StateFile, byteValue, 0644)
+}
+
+// readState returns the pools in breach of earlier runs, a state file that cannot be
+// read is an error rather than an empty state that would page for every pool again
+func readState(filename string) (map[string]alertState, error) {
+	state := make(map[string]alertState)
+	byteValue, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return state, err
+	}
+	if err := json.Unmarshal(byteValue, &state); err != nil {
+		return state, fmt.Errorf("%s: %w", filename, err)
+	}
+	return state, nil
+}
+
+// evaluate returns the alerts to send and updates state with them
+func evaluate(config AlertConfig, renotify time.Duration, pools model.Pools, state map[string]alertState, now time.Time) []Alert {
+	var alerts []Alert
+	for _, pool := range pools.Pools {
+		key := pool.ArrayName + "/" + pool.Id
+		alert := evaluatePool(config, pool, now)
+		previous, known := state[key]
+		if alert.Level == "ok" {
+			if known {
+				alert.Reason = "cleared, was " + previous.Level
+				alerts = append(alerts, alert)
+				delete(state, key)
+			}
+			continue
+		}
+		if !known || previous.Level != alert.Level {
+			state[key] = alertState{Level: alert.Level, Since: alert.Time, LastNotified: alert.Time}
+			alerts = append(alerts, alert)
+		} else if alert.Time.Sub(previous.LastNotified) >= renotify {
+			previous.LastNotified = alert.Time
+			state[key] = previous
+			alert.Reason += ", ongoing since " + previous.Since.Format(time.RFC3339)
+			alerts = append(alerts, alert)
+		}
+	}
+	// pools that were not collected this run keep their state so
+	// an unreachable array does not look like a cleared alert
+	return alerts
+}
+
+// notifyAll sends the alerts to every sink, also after one of them failed
+func notifyAll(sinks []notifier, alerts []Alert) error {
+	var failed error
+	for _, sink := range sinks {
+		if err := sink.notify(alerts); err != nil {
+			slog.Error("alert notification failed", "phase", "alerts", "error", err)
+			if failed == nil {
+				failed = fmt.Errorf("notifying %d alerts: %w", len(alerts), err)
+			}
+		}
+	}
+	return failed
+}
+
+func (config AlertConfig) notifiers() []notifier {
+	var sinks []notifier
+	if config.Webhook != "" {
+		sinks = append(sinks, webhookNotifier{url: config.Webhook})
+	}
+	if config.SMTP.Host != "" {
+		sinks = append(sinks, smtpNotifier{config: config.SMTP})
+	}
+	if config.File != "" {
+		sinks = append(sinks, fileNotifier{filename: config.File})
+	}
+	return sinks
+}
+
+func formatAlert(alert Alert) string {
+	return strings.ToUpper(alert.Level) + " " + alert.ArrayName + " " + alert.PoolName + " (" + alert.Client + ", " + alert.Site + ", " + alert.Type + ") used " + fmt.Sprintf("%.1f", alert.UsedPCT) + "% threshold " + fmt.Sprintf("%.1f", alert.Threshold) + "%: " + alert.Reason
+}
+
+type webhookNotifier struct {
+	url string
+}
+
+func (w webhookNotifier) notify(alerts []Alert) error {
+	byteValue, err := json.Marshal(alerts)
+	if err != nil {
+		return err
+	}
+	resp, err := http.Post(w.url, "application/json; charset=utf-8", bytes.NewBuffer(byteValue))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook: %s returned %s", w.url, resp.Status)
+	}
+	return nil
+}
+
+type smtpNotifier struct {
+	config SMTPConfig
+}
+
+func (s smtpNotifier) notify(alerts []Alert) error {
+	port := s.config.Port
+	if port == 0 {
+		port = 25
+	}
+	var body strings.Builder
+	body.WriteString("From: " + s.config.From + "\r\n")
+	body.WriteString("To: " + strings.Join(s.config.To, ", ") + "\r\n")
+	body.WriteString("Subject: GoData capacity alerts (" + strconv.Itoa(len(alerts)) + ")\r\n\r\n")
+	for _, alert := range alerts {
+		body.WriteString(formatAlert(alert) + "\r\n")
+	}
+	var auth smtp.Auth
+	if s.config.Username != "" {
+		auth = smtp.PlainAuth("", s.config.Username, s.config.Password, s.config.Host)
+	}
+	return smtp.SendMail(s.config.Host+":"+strconv.Itoa(port), auth, s.config.From, s.config.To, []byte(body.String()))
+}
+
+type fileNotifier struct {
+	filename string
+}
+
+func (f fileNotifier) notify(alerts []Alert) error {
+	file, err := os.OpenFile(f.filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	for _, alert := range alerts {
+		_, err = file.WriteString(alert.Time.Format(time.RFC3339) + " " + formatAlert(alert) + "\n")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
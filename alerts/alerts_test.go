@@ -0,0 +1,180 @@
+package alerts
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"dataCollection/model"
+)
+
+func TestEvaluate(t *testing.T) {
+	config := AlertConfig{Thresholds: []Threshold{{Warning: 80, Critical: 90}}}
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	pool := func(used float64) model.Pools {
+		return model.Pools{Pools: []model.Pool{{ArrayName: "A", Id: "0", PoolName: "P0", PoolCapacityPCT: used}}}
+	}
+	tests := []struct {
+		name      string
+		state     map[string]alertState
+		used      float64
+		want      []string
+		wantState string
+		notified  time.Time
+	}{
+		{name: "new breach", used: 0.85, want: []string{"warning"}, wantState: "warning", notified: now},
+		{name: "below every threshold", used: 0.5},
+		{
+			name:      "same level is not sent again",
+			state:     map[string]alertState{"A/0": {Level: "warning", Since: now.Add(-time.Hour), LastNotified: now.Add(-time.Hour)}},
+			used:      0.85,
+			wantState: "warning",
+			notified:  now.Add(-time.Hour),
+		},
+		{
+			name:      "reminder after renotify",
+			state:     map[string]alertState{"A/0": {Level: "warning", Since: now.Add(-25 * time.Hour), LastNotified: now.Add(-25 * time.Hour)}},
+			used:      0.85,
+			want:      []string{"warning"},
+			wantState: "warning",
+			notified:  now,
+		},
+		{
+			name:      "level change",
+			state:     map[string]alertState{"A/0": {Level: "warning", Since: now.Add(-time.Hour), LastNotified: now.Add(-time.Hour)}},
+			used:      0.95,
+			want:      []string{"critical"},
+			wantState: "critical",
+			notified:  now,
+		},
+		{
+			name:  "cleared",
+			state: map[string]alertState{"A/0": {Level: "critical", Since: now.Add(-time.Hour), LastNotified: now.Add(-time.Hour)}},
+			used:  0.5,
+			want:  []string{"ok"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			state := test.state
+			if state == nil {
+				state = make(map[string]alertState)
+			}
+			alerts := evaluate(config, 24*time.Hour, pool(test.used), state, now)
+			if len(alerts) != len(test.want) {
+				t.Fatalf("%d alerts, want %d", len(alerts), len(test.want))
+			}
+			for i, alert := range alerts {
+				if alert.Level != test.want[i] {
+					t.Errorf("alert %d is %s, want %s", i, alert.Level, test.want[i])
+				}
+			}
+			got, known := state["A/0"]
+			if test.wantState == "" {
+				if known {
+					t.Errorf("state kept %s, want none", got.Level)
+				}
+				return
+			}
+			if got.Level != test.wantState || !got.LastNotified.Equal(test.notified) {
+				t.Errorf("state %s notified %s, want %s notified %s", got.Level, got.LastNotified, test.wantState, test.notified)
+			}
+		})
+	}
+}
+
+func TestEvaluateKeepsPoolsNotCollected(t *testing.T) {
+	now := time.Now()
+	state := map[string]alertState{"B/0": {Level: "critical", Since: now, LastNotified: now}}
+	alerts := evaluate(AlertConfig{Thresholds: []Threshold{{Critical: 90}}}, time.Hour, model.Pools{}, state, now)
+	if len(alerts) != 0 || state["B/0"].Level != "critical" {
+		t.Errorf("alerts %v and state %v, want the state of B kept without alerts", alerts, state)
+	}
+}
+
+func TestMatchThreshold(t *testing.T) {
+	thresholds := []Threshold{
+		{Warning: 80},
+		{Client: "P16", Warning: 70},
+		{Client: "P16", Site: "DC1", Warning: 60},
+	}
+	tests := []struct {
+		pool model.Pool
+		want float64
+	}{
+		{model.Pool{Client: "Z141", Site: "DC1"}, 80},
+		{model.Pool{Client: "P16", Site: "DC2"}, 70},
+		{model.Pool{Client: "P16", Site: "DC1"}, 60},
+	}
+	for _, test := range tests {
+		threshold, found := matchThreshold(thresholds, test.pool)
+		if !found || threshold.Warning != test.want {
+			t.Errorf("%s/%s matched warning %v, want %v", test.pool.Client, test.pool.Site, threshold.Warning, test.want)
+		}
+	}
+}
+
+// writeConfig writes an alerts file into dir and returns its name
+func writeConfig(t *testing.T, dir string, config AlertConfig) string {
+	byteValue, err := json.Marshal(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(dir, "alerts.json")
+	if err := ioutil.WriteFile(filename, byteValue, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func TestCheckFailedNotificationKeepsState(t *testing.T) {
+	status := http.StatusInternalServerError
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+	dir := t.TempDir()
+	stateFile := filepath.Join(dir, "alerts_state.json")
+	configFile := writeConfig(t, dir, AlertConfig{Thresholds: []Threshold{{Warning: 80}}, Webhook: server.URL, StateFile: stateFile})
+	pools := model.Pools{Pools: []model.Pool{{ArrayName: "A", Id: "0", PoolCapacityPCT: 0.85}}}
+
+	if err := Check(pools, configFile); err == nil {
+		t.Fatal("no error after the webhook failed")
+	}
+	if _, err := ioutil.ReadFile(stateFile); err == nil {
+		t.Fatal("state written after the webhook failed")
+	}
+	status = http.StatusOK
+	if err := Check(pools, configFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Check(pools, configFile); err != nil {
+		t.Fatal(err)
+	}
+	if requests != 2 {
+		t.Errorf("%d webhook requests, want the failed one and one retry", requests)
+	}
+}
+
+func TestCheckBrokenState(t *testing.T) {
+	dir := t.TempDir()
+	stateFile := filepath.Join(dir, "alerts_state.json")
+	if err := ioutil.WriteFile(stateFile, []byte(`{"A/0": {"level": "warn`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	configFile := writeConfig(t, dir, AlertConfig{Thresholds: []Threshold{{Warning: 80}}, StateFile: stateFile})
+	pools := model.Pools{Pools: []model.Pool{{ArrayName: "A", Id: "0", PoolCapacityPCT: 0.85}}}
+	if err := Check(pools, configFile); err == nil {
+		t.Error("no error for a truncated state file")
+	}
+	byteValue, _ := ioutil.ReadFile(stateFile)
+	if string(byteValue) != `{"A/0": {"level": "warn` {
+		t.Error("truncated state file was overwritten")
+	}
+}
@@ -1,2 +1,2 @@
 #!/bin/bash
-GOOS=linux GOARCH=amd64 CGO_ENABLED=0 go build -o GoData dataCollection.go
+GOOS=linux GOARCH=amd64 CGO_ENABLED=0 go build -o GoData ./cmd/godata
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"dataCollection/collector"
+	"dataCollection/model"
+	"dataCollection/transport"
+	"dataCollection/transport/ssh"
+	"dataCollection/vendors"
+)
+
+// fixtureSlug makes a product model or code level usable as a directory name
+func fixtureSlug(value string) string {
+	return strings.Trim(regexp.MustCompile(`[^A-Za-z0-9._]+`).ReplaceAllString(value, "-"), "-")
+}
+
+// redactOutputs replaces serials, WWNs, locations and names in the recorded
+// output so fixtures of production arrays can be shared
+func redactOutputs(outputs map[string][]byte, array model.Array, system model.System, pools model.Pools) {
+	replacements := map[string]string{
+		array.Name:      "ARRAY01",
+		array.Ip:        "192.0.2.1",
+		system.Serial:   "SERIAL0001",
+		system.WWN:      strings.Repeat("0", len(system.WWN)),
+		system.Location: "LOCATION01",
+	}
+	firmware := outputs[vendors.Commands[array.Model].Firmware]
+	switch array.Model {
+	case "huawei":
+		replacements[vendors.HuaweiSystemValues(firmware)["System Name"]] = "ARRAY01"
+	case "ontap":
+		replacements[vendors.ONTAPSystemValues(firmware)["name"]] = "ARRAY01"
+	default:
+		replacements[vendors.IBMSystemValues(firmware)["name"]] = "ARRAY01"
+	}
+	for _, pool := range pools.Pools {
+		replacements[pool.PoolName] = "POOL" + pool.Id
+	}
+	delete(replacements, "")
+
+	// longest first so a value that contains another one is replaced whole
+	var keys []string
+	for key := range replacements {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return len(keys[i]) > len(keys[j])
+	})
+	for command, output := range outputs {
+		for _, key := range keys {
+			re := regexp.MustCompile(`\b` + regexp.QuoteMeta(key) + `\b`)
+			output = re.ReplaceAll(output, []byte(replacements[key]))
+		}
+		outputs[command] = output
+	}
+}
+
+// runCapture records the output of every command of one array into
+// root/vendor/model/code-level so it can be replayed with -test
+func runCapture(cfg config, name string, redact bool) int {
+	arrays, err := cfg.loadInventory()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	for _, array := range arrays {
+		if array.Name != name {
+			continue
+		}
+		commands, ok := vendors.Commands[array.Model]
+		if !ok {
+			fmt.Fprintln(os.Stderr, "unsupported model "+array.Model)
+			return 1
+		}
+		conns := cfg.newManager(false)
+		defer conns.Close()
+		runner := transport.Guard{
+			Allow: func(command string) error { return vendors.Allowed(array.Model, command) },
+			Audit: cfg.audit,
+			Array: array.Name,
+			Host:  array.Ip,
+			User:  cfg.Username,
+		}
+		runner.Runner, err = collector.ArrayRunner(array, conns, "")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if runner.Runner == nil {
+			client, err := conns.Get(context.Background(), ssh.TargetOf(array))
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+			defer conns.Release(array.Ip, client, false)
+			runner.Runner = conns.Runner(client)
+		}
+		outputs := make(map[string][]byte)
+		for _, command := range []string{commands.Data, commands.Firmware} {
+			output, _, err := runner.Run(context.Background(), command)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+			outputs[command] = output
+		}
+
+		system, err := vendors.ParseSystem(outputs[commands.Firmware], array.Model, array.Name, array.Site, array.Client)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		pools, err := vendors.ParsePools(outputs[commands.Data], outputs[commands.Firmware], array.Model, array.Name, array.Site, array.Type, array.Client)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		if system.Model == "" || system.Firmware == "" {
+			fmt.Fprintln(os.Stderr, "could not read product model and code level from "+commands.Firmware)
+			return 1
+		}
+		if redact {
+			redactOutputs(outputs, array, system, pools)
+		}
+
+		codeLevel := strings.TrimSpace(system.Firmware + " " + system.Patch)
+		if array.Transport == model.TransportREST {
+			// json next to the cli output of the same code level
+			codeLevel += " rest"
+		}
+		dir := filepath.Join(cfg.Fixtures, array.Model, fixtureSlug(system.Model), fixtureSlug(codeLevel))
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		for command, output := range outputs {
+			if err := ioutil.WriteFile(filepath.Join(dir, transport.CommandFile(command)), output, 0644); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+		}
+		fmt.Println(strconv.Itoa(len(pools.Pools)) + " pools recorded in " + dir)
+		return 0
+	}
+	fmt.Fprintln(os.Stderr, "array "+name+" not found in inventory")
+	return 1
+}
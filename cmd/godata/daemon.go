@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"dataCollection/inventory"
+	"dataCollection/model"
+	"dataCollection/output"
+)
+
+// Schedule struct which contains one collection schedule,
+// empty model, site and client match every array
+type Schedule struct {
+	Name     string   `json:"name"`
+	Scope    string   `json:"scope"`
+	Interval string   `json:"interval"`
+	Jitter   string   `json:"jitter"`
+	Model    string   `json:"model"`
+	Site     string   `json:"site"`
+	Client   string   `json:"client"`
+	Arrays   []string `json:"arrays"`
+	interval time.Duration
+	jitter   time.Duration
+}
+
+type Schedules struct {
+	Schedules []Schedule `json:"schedules"`
+}
+
+func daemonFlags(fs *flag.FlagSet, cfg *config) {
+	fs.DurationVar(&cfg.Interval, "interval", envDuration("GODATA_INTERVAL", 15*time.Minute), "collection interval when no schedule file is used ($GODATA_INTERVAL)")
+	fs.DurationVar(&cfg.Jitter, "jitter", envDuration("GODATA_JITTER", time.Minute), "random delay added to every interval ($GODATA_JITTER)")
+	fs.StringVar(&cfg.Schedules, "schedules", envString("GODATA_SCHEDULES", ""), "schedule file with per group intervals and scopes ($GODATA_SCHEDULES)")
+	fs.StringVar(&cfg.Listen, "listen", envString("GODATA_LISTEN", ""), "address serving prometheus /metrics, for example :9105 ($GODATA_LISTEN)")
+	fs.DurationVar(&cfg.SSHKeepAlive, "ssh-keepalive", envDuration("GODATA_SSH_KEEPALIVE", 0), "keep ssh connections open between cycles and check them this often, 0 reconnects every cycle ($GODATA_SSH_KEEPALIVE)")
+}
+
+// loadSchedules reads the schedule file, without one everything
+// is collected on the interval and jitter flags
+func loadSchedules(cfg config) ([]Schedule, error) {
+	if cfg.Schedules == "" {
+		return []Schedule{{Name: "all", Scope: "all", interval: cfg.Interval, jitter: cfg.Jitter}}, nil
+	}
+	byteValue, err := ioutil.ReadFile(cfg.Schedules)
+	if err != nil {
+		return nil, err
+	}
+	var schedules Schedules
+	if err := json.Unmarshal(byteValue, &schedules); err != nil {
+		return nil, fmt.Errorf("%s: %s", cfg.Schedules, err.Error())
+	}
+	for i := range schedules.Schedules {
+		schedule := &schedules.Schedules[i]
+		if schedule.Name == "" {
+			schedule.Name = "schedule" + strconv.Itoa(i)
+		}
+		if schedule.Scope == "" {
+			schedule.Scope = "all"
+		}
+		if schedule.Scope != "all" && schedule.Scope != "capacity" && schedule.Scope != "system" {
+			return nil, fmt.Errorf("schedule %s: unknown scope %s", schedule.Name, schedule.Scope)
+		}
+		schedule.interval, err = time.ParseDuration(schedule.Interval)
+		if err != nil || schedule.interval <= 0 {
+			return nil, fmt.Errorf("schedule %s: invalid interval %q", schedule.Name, schedule.Interval)
+		}
+		if schedule.Jitter != "" {
+			schedule.jitter, err = time.ParseDuration(schedule.Jitter)
+			if err != nil {
+				return nil, fmt.Errorf("schedule %s: invalid jitter %q", schedule.Name, schedule.Jitter)
+			}
+		}
+	}
+	return schedules.Schedules, nil
+}
+
+func (schedule Schedule) matches(array model.Array) bool {
+	if schedule.Model != "" && schedule.Model != array.Model {
+		return false
+	}
+	if schedule.Site != "" && schedule.Site != array.Site {
+		return false
+	}
+	if schedule.Client != "" && schedule.Client != array.Client {
+		return false
+	}
+	if len(schedule.Arrays) > 0 {
+		for _, name := range schedule.Arrays {
+			if name == array.Name {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func (schedule Schedule) next() time.Duration {
+	wait := schedule.interval
+	if schedule.jitter > 0 {
+		wait += time.Duration(rand.Int63n(int64(schedule.jitter)))
+	}
+	return wait
+}
+
+func runDaemon(cfg config) int {
+	schedules, err := loadSchedules(cfg)
+	if err != nil {
+		logger.Error("loading schedules failed", "phase", "daemon", "error", err)
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	if cfg.Listen != "" {
+		cfg.exporter = output.NewMetricsExporter()
+		if !cfg.outputs()["prometheus"] {
+			cfg.Output += ",prometheus"
+		}
+		server := &http.Server{Addr: cfg.Listen, Handler: cfg.exporter.Handler()}
+		go func() {
+			if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.Error("metrics server failed", "phase", "daemon", "error", err)
+				stop()
+			}
+		}()
+		defer server.Shutdown(context.Background())
+	}
+
+	if cfg.SSHKeepAlive > 0 {
+		cfg.conns = cfg.newManager(true)
+		cfg.conns.KeepAlive(cfg.SSHKeepAlive)
+		defer cfg.conns.Close()
+	}
+
+	// one breaker for all schedules, they collect the same arrays with the same account
+	cfg.breaker = cfg.lockedBreaker()
+
+	logger.Info("daemon started", "phase", "daemon", "schedules", len(schedules))
+	var wg sync.WaitGroup
+	for _, schedule := range schedules {
+		wg.Add(1)
+		go func(schedule Schedule) {
+			defer wg.Done()
+			runSchedule(ctx, cfg, schedule)
+		}(schedule)
+	}
+	wg.Wait()
+	logger.Info("daemon stopped", "phase", "daemon")
+	return 0
+}
+
+// runSchedule runs a cycle right away and then after every interval until
+// ctx is cancelled, a cycle that is running stops its commands and still writes
+// what it collected so far
+func runSchedule(ctx context.Context, cfg config, schedule Schedule) {
+	for {
+		runScheduledCycle(ctx, cfg, schedule)
+		timer := time.NewTimer(schedule.next())
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+func runScheduledCycle(ctx context.Context, cfg config, schedule Schedule) {
+	// the inventory is read every cycle so changes do not need a restart
+	arrays, err := cfg.loadInventory()
+	if err != nil {
+		logger.Error("loading inventory failed", "phase", "daemon", "schedule", schedule.Name, "error", err)
+		return
+	}
+	arrays = inventory.FilterClient(arrays, cfg.Client)
+	var selected []model.Array
+	for _, array := range arrays {
+		if schedule.matches(array) {
+			selected = append(selected, array)
+		}
+	}
+
+	selected, locks := lockArrays(cfg.LockDir, selected)
+	defer locks.release()
+	if len(selected) == 0 {
+		logger.Warn("skipping cycle, every array is being collected elsewhere", "phase", "daemon", "schedule", schedule.Name)
+		return
+	}
+	runCycle(ctx, cfg, arrays, selected, schedule)
+}
+
+// runLock is a lock file holding the pid of the process collecting an array or
+// writing the state files, it keeps overlapping schedules and cron runs apart
+type runLock struct {
+	filename string
+}
+
+type runLocks []*runLock
+
+// lockArrays takes the lock of every array, arrays that another schedule or
+// a cron run is collecting right now are left out of this cycle
+func lockArrays(dir string, arrays []model.Array) (locked []model.Array, locks runLocks) {
+	for _, array := range arrays {
+		lock, err := acquireLock(dir, "array-"+fixtureSlug(array.Name))
+		if err != nil {
+			logger.Warn("skipping array", "array", array.Name, "phase", "lock", "error", err)
+			continue
+		}
+		locked = append(locked, array)
+		locks = append(locks, lock)
+	}
+	return locked, locks
+}
+
+func (locks runLocks) release() {
+	for _, lock := range locks {
+		lock.release()
+	}
+}
+
+// waitLock waits up to timeout for a lock that is only held for a moment,
+// like the one around reading and writing the state files
+func waitLock(dir, scope string, timeout time.Duration) (*runLock, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		lock, err := acquireLock(dir, scope)
+		if err == nil || time.Now().After(deadline) {
+			return lock, err
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func acquireLock(dir, scope string) (*runLock, error) {
+	filename := filepath.Join(dir, "godata-"+scope+".lock")
+	for attempt := 0; attempt < 2; attempt++ {
+		file, err := os.OpenFile(filename, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			file.WriteString(strconv.Itoa(os.Getpid()))
+			file.Close()
+			return &runLock{filename: filename}, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		byteValue, _ := ioutil.ReadFile(filename)
+		pid, _ := strconv.Atoi(strings.TrimSpace(string(byteValue)))
+		if pid > 0 && processAlive(pid) {
+			return nil, fmt.Errorf("%s is already running in process %d", scope, pid)
+		}
+		// the previous holder died without cleaning up
+		os.Remove(filename)
+	}
+	return nil, fmt.Errorf("could not lock %s", filename)
+}
+
+func (lock *runLock) release() {
+	os.Remove(lock.filename)
+}
+
+func processAlive(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	return process.Signal(syscall.Signal(0)) == nil
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"dataCollection/model"
+	"dataCollection/store"
+)
+
+// runHistory answers the history subcommands against the store
+func runHistory(cfg config, args []string) int {
+	if cfg.Store == "" {
+		fmt.Fprintln(os.Stderr, "history needs -store")
+		return 2
+	}
+	store := store.Store{Path: cfg.Store}
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, "usage: GoData history [flags] runs | pool <array>/<pool id or name> | diff <run> <run> | compact\n")
+		return 2
+	}
+	since := time.Now().AddDate(0, 0, -cfg.HistoryDays)
+	switch args[0] {
+	case "runs":
+		snapshots, err := store.Runs(since)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "RUN\tSCHEDULE\tSCOPE\tPOOLS\tSYSTEMS\tCLIENTS")
+		for _, snapshot := range snapshots {
+			fmt.Fprintln(w, snapshot.Time.Format(time.RFC3339)+"\t"+orDash(snapshot.Schedule)+"\t"+orDash(snapshot.Scope)+"\t"+strconv.Itoa(len(snapshot.Pools))+"\t"+strconv.Itoa(len(snapshot.Systems))+"\t"+strconv.Itoa(len(snapshot.Clients)))
+		}
+		w.Flush()
+	case "pool":
+		if len(args) != 2 || !strings.Contains(args[1], "/") {
+			fmt.Fprint(os.Stderr, "usage: GoData history pool <array>/<pool id or name>\n")
+			return 2
+		}
+		parts := strings.SplitN(args[1], "/", 2)
+		snapshots, err := store.Runs(since)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "RUN\tPOOL\tTOTAL TB\tFREE TB\tUSED TB\tUSED %\tSTALE")
+		for _, snapshot := range snapshots {
+			for _, pool := range snapshot.Pools {
+				if pool.ArrayName == parts[0] && (pool.Id == parts[1] || pool.PoolName == parts[1]) {
+					fmt.Fprintln(w, snapshot.Time.Format(time.RFC3339)+"\t"+pool.PoolName+"\t"+model.Terabytes(pool.PoolCapacity)+"\t"+model.Terabytes(pool.PoolCapacityFree)+"\t"+model.Terabytes(pool.PoolCapacityUsed)+"\t"+fmt.Sprintf("%.1f", pool.PoolCapacityPCT*100)+"\t"+strconv.FormatBool(pool.Stale))
+				}
+			}
+		}
+		w.Flush()
+	case "diff":
+		if len(args) != 3 {
+			fmt.Fprint(os.Stderr, "usage: GoData history diff <run> <run>, a run is a time from \"history runs\", latest or previous\n")
+			return 2
+		}
+		snapshots, err := store.Runs(time.Time{})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		from, err := findRun(snapshots, args[1])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		to, err := findRun(snapshots, args[2])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		printDiff(from, to)
+	case "compact":
+		removed, err := store.Compact(cfg.StoreRaw, cfg.StoreRetention, time.Now())
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Println(strconv.Itoa(removed) + " runs removed")
+	default:
+		fmt.Fprintln(os.Stderr, "unknown history command "+args[0])
+		return 2
+	}
+	return 0
+}
+
+// findRun picks a run by its time, the latest one or the one before the latest of the
+// same schedule and scope, so a system or subset run is never compared with a full one
+func findRun(snapshots []model.Snapshot, name string) (model.Snapshot, error) {
+	switch name {
+	case "latest":
+		if len(snapshots) > 0 {
+			return snapshots[len(snapshots)-1], nil
+		}
+	case "previous":
+		if len(snapshots) > 1 {
+			latest := snapshots[len(snapshots)-1]
+			for i := len(snapshots) - 2; i >= 0; i-- {
+				if snapshots[i].Scope == latest.Scope && snapshots[i].Schedule == latest.Schedule {
+					return snapshots[i], nil
+				}
+			}
+		}
+	default:
+		t, err := time.Parse(time.RFC3339, name)
+		if err != nil {
+			return model.Snapshot{}, err
+		}
+		for _, snapshot := range snapshots {
+			if snapshot.Time.Truncate(time.Second).Equal(t) {
+				return snapshot, nil
+			}
+		}
+	}
+	return model.Snapshot{}, fmt.Errorf("run %s not found", name)
+}
+
+// printDiff shows per pool how total and used capacity changed between two runs
+func printDiff(from, to model.Snapshot) {
+	fromPools := make(map[string]model.Pool)
+	for _, pool := range from.Pools {
+		fromPools[pool.ArrayName+"/"+pool.Id] = pool
+	}
+	toPools := make(map[string]model.Pool)
+	var keys []string
+	for _, pool := range to.Pools {
+		key := pool.ArrayName + "/" + pool.Id
+		toPools[key] = pool
+		keys = append(keys, key)
+	}
+	for key := range fromPools {
+		if _, ok := toPools[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	fmt.Println("from " + from.Time.Format(time.RFC3339) + " to " + to.Time.Format(time.RFC3339))
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "POOL\tNAME\tCHANGE\tTOTAL TB\tUSED TB\tUSED %")
+	for _, key := range keys {
+		before, inFrom := fromPools[key]
+		after, inTo := toPools[key]
+		change := "changed"
+		switch {
+		case !inFrom:
+			change = "added"
+		case !inTo:
+			change = "removed"
+			after = model.Pool{PoolName: before.PoolName}
+		case before.PoolCapacity == after.PoolCapacity && before.PoolCapacityUsed == after.PoolCapacityUsed:
+			change = "unchanged"
+		}
+		fmt.Fprintln(w, key+"\t"+after.PoolName+"\t"+change+"\t"+signedTerabytes(after.PoolCapacity-before.PoolCapacity)+"\t"+signedTerabytes(after.PoolCapacityUsed-before.PoolCapacityUsed)+"\t"+fmt.Sprintf("%+.1f", (after.PoolCapacityPCT-before.PoolCapacityPCT)*100))
+	}
+	w.Flush()
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+func signedTerabytes(bytes float64) string {
+	return fmt.Sprintf("%+.2f", bytes/1024/1024/1024/1024)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// logger is used everywhere instead of the log package, until
+// setupLogging runs it writes text to stderr. setupLogging also makes
+// it the slog default, which the library packages log to
+var logger = slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+// setupLogging builds the logger from the log flags, output is either
+// "stderr" or a directory that gets one file per day
+func setupLogging(level, format, output string, retentionDays int) error {
+	var slogLevel slog.Level
+	if err := slogLevel.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("invalid log level %q", level)
+	}
+
+	var w io.Writer = os.Stderr
+	if output != "stderr" && output != "" {
+		daily, err := newDailyWriter(output, "godata", retentionDays)
+		if err != nil {
+			return err
+		}
+		w = daily
+	}
+
+	options := &slog.HandlerOptions{Level: slogLevel}
+	switch format {
+	case "text":
+		logger = slog.New(slog.NewTextHandler(w, options))
+	case "json":
+		logger = slog.New(slog.NewJSONHandler(w, options))
+	default:
+		return fmt.Errorf("invalid log format %q", format)
+	}
+	slog.SetDefault(logger)
+	return nil
+}
+
+// dailyWriter writes to dir/prefix.YYYYMMDD.log, switches file when
+// the date changes and removes files older than retention days
+type dailyWriter struct {
+	mu        sync.Mutex
+	dir       string
+	prefix    string
+	retention int
+	day       string
+	file      *os.File
+}
+
+func newDailyWriter(dir, prefix string, retention int) (*dailyWriter, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	w := &dailyWriter{dir: dir, prefix: prefix, retention: retention}
+	if err := w.rotate(time.Now()); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *dailyWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if now := time.Now(); now.Format("20060102") != w.day {
+		if err := w.rotate(now); err != nil {
+			return 0, err
+		}
+	}
+	return w.file.Write(p)
+}
+
+func (w *dailyWriter) rotate(now time.Time) error {
+	day := now.Format("20060102")
+	file, err := os.OpenFile(filepath.Join(w.dir, w.prefix+"."+day+".log"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if w.file != nil {
+		w.file.Close()
+	}
+	w.file = file
+	w.day = day
+	w.prune(now)
+	return nil
+}
+
+// prune removes log files of days that fall outside the retention
+func (w *dailyWriter) prune(now time.Time) {
+	if w.retention <= 0 {
+		return
+	}
+	matches, err := filepath.Glob(filepath.Join(w.dir, w.prefix+".*.log"))
+	if err != nil {
+		return
+	}
+	sort.Strings(matches)
+	oldest := now.AddDate(0, 0, -w.retention).Format("20060102")
+	for _, match := range matches {
+		day := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(match), w.prefix+"."), ".log")
+		if len(day) == 8 && day < oldest {
+			os.Remove(match)
+		}
+	}
+}
@@ -0,0 +1,695 @@
+// Command godata collects the storage pool capacity of the inventory
+// arrays and writes it to the configured outputs.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"dataCollection/aggregate"
+	"dataCollection/alerts"
+	"dataCollection/collector"
+	"dataCollection/forecast"
+	"dataCollection/inventory"
+	"dataCollection/model"
+	"dataCollection/output"
+	"dataCollection/store"
+	"dataCollection/transport"
+	"dataCollection/transport/ssh"
+)
+
+const usage = `usage: GoData <command> [flags]
+
+commands:
+  collect             collect all arrays and write the results to the output
+  print               collect all arrays and print the results
+  validate-inventory  check the inventory files for mistakes
+  probe <array>       collect a single array and print its raw and parsed output
+  capture <array>     record the command output of an array as test fixtures
+  daemon              keep running and collect on a schedule
+  history             query the local store: runs, pool <array>/<pool>, diff <run> <run>, compact
+
+every flag can also be set with the environment variable shown in its help,
+run "GoData <command> -h" to list them
+`
+
+// config struct which contains everything that
+// used to be edited in main before building
+type config struct {
+	Username          string
+	Password          string
+	Inventory         string
+	Output            string
+	OutputDir         string
+	InfluxURL         string
+	Client            string
+	Concurrency       int
+	Test              bool
+	Fixtures          string
+	AlertsFile        string
+	Forecast          bool
+	ForecastDays      int
+	ForecastThreshold float64
+	History           string
+	HistoryFile       string
+	LockDir           string
+	Interval          time.Duration
+	Jitter            time.Duration
+	Schedules         string
+	Listen            string
+	Report            string
+	StateFile         string
+	Store             string
+	StoreRaw          time.Duration
+	StoreRetention    time.Duration
+	HistoryDays       int
+	StaleMaxAge       time.Duration
+	LogLevel          string
+	LogFormat         string
+	LogOutput         string
+	LogRetention      int
+	SSHKeepAlive      time.Duration
+	Route             string
+	CommandTimeout    time.Duration
+	MaxOutput         int
+	Retries           int
+	RetryBackoff      time.Duration
+	BreakerThreshold  int
+	BreakerCoolDown   time.Duration
+	BreakerFile       string
+	AuditLog          string
+	exporter          *output.MetricsExporter
+	conns             *ssh.Manager
+	breaker           *collector.Breaker
+	audit             *transport.AuditLog
+}
+
+var knownOutputs = map[string]bool{
+	"influx":     true,
+	"stdout":     true,
+	"prometheus": true,
+	"json":       true,
+	"csv":        true,
+	"ndjson":     true,
+}
+
+func (cfg config) outputs() map[string]bool {
+	outputs := make(map[string]bool)
+	for _, output := range strings.Split(cfg.Output, ",") {
+		output = strings.TrimSpace(output)
+		if output != "" {
+			outputs[output] = true
+		}
+	}
+	return outputs
+}
+
+func (cfg config) checkOutputs() error {
+	for output := range cfg.outputs() {
+		if !knownOutputs[output] {
+			return fmt.Errorf("unknown output %s", output)
+		}
+	}
+	return nil
+}
+
+func envString(name, value string) string {
+	if env, ok := os.LookupEnv(name); ok {
+		return env
+	}
+	return value
+}
+
+// envInvalid stops on an environment variable that does not parse, like the
+// flag package does on a flag value, rather than quietly using the default
+func envInvalid(name, env string, err error) {
+	fmt.Fprintf(os.Stderr, "invalid value %q for $%s: %v\n", env, name, err)
+	os.Exit(2)
+}
+
+func envInt(name string, value int) int {
+	if env, ok := os.LookupEnv(name); ok {
+		parsed, err := strconv.Atoi(env)
+		if err != nil {
+			envInvalid(name, env, err)
+		}
+		return parsed
+	}
+	return value
+}
+
+func envFloat(name string, value float64) float64 {
+	if env, ok := os.LookupEnv(name); ok {
+		parsed, err := strconv.ParseFloat(env, 64)
+		if err != nil {
+			envInvalid(name, env, err)
+		}
+		return parsed
+	}
+	return value
+}
+
+func envBool(name string, value bool) bool {
+	if env, ok := os.LookupEnv(name); ok {
+		parsed, err := strconv.ParseBool(env)
+		if err != nil {
+			envInvalid(name, env, err)
+		}
+		return parsed
+	}
+	return value
+}
+
+func envDuration(name string, value time.Duration) time.Duration {
+	if env, ok := os.LookupEnv(name); ok {
+		parsed, err := time.ParseDuration(env)
+		if err != nil {
+			envInvalid(name, env, err)
+		}
+		return parsed
+	}
+	return value
+}
+
+// newFlagSet registers the flags shared by all commands, environment
+// variables provide the defaults and flags override them
+func newFlagSet(name string, cfg *config) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.StringVar(&cfg.Username, "username", envString("GODATA_USERNAME", ""), "array user name ($GODATA_USERNAME)")
+	fs.StringVar(&cfg.Password, "password", envString("GODATA_PASSWORD", ""), "array password ($GODATA_PASSWORD)")
+	fs.StringVar(&cfg.Inventory, "inventory", envString("GODATA_INVENTORY", ""), "comma separated model=file inventory list, default ibm=IBM.json,huawei=huawei.json ($GODATA_INVENTORY)")
+	fs.StringVar(&cfg.Output, "output", envString("GODATA_OUTPUT", "influx"), "comma separated outputs: influx, stdout, prometheus, json, csv, ndjson ($GODATA_OUTPUT)")
+	fs.StringVar(&cfg.OutputDir, "output-dir", envString("GODATA_OUTPUT_DIR", "out"), "directory for json, csv and ndjson files ($GODATA_OUTPUT_DIR)")
+	fs.StringVar(&cfg.InfluxURL, "influx-url", envString("GODATA_INFLUX_URL", "http://xxx/write?db=capacity_metrics"), "influx write url ($GODATA_INFLUX_URL)")
+	fs.StringVar(&cfg.Client, "client", envString("GODATA_CLIENT", ""), "only collect arrays of this client, empty for all ($GODATA_CLIENT)")
+	fs.IntVar(&cfg.Concurrency, "concurrency", envInt("GODATA_CONCURRENCY", 4), "number of arrays collected at the same time ($GODATA_CONCURRENCY)")
+	fs.DurationVar(&cfg.CommandTimeout, "command-timeout", envDuration("GODATA_COMMAND_TIMEOUT", ssh.DefaultCommandTimeout), "time every array command gets before it is killed ($GODATA_COMMAND_TIMEOUT)")
+	fs.IntVar(&cfg.MaxOutput, "max-output", envInt("GODATA_MAX_OUTPUT", ssh.DefaultMaxOutput), "bytes of stdout or stderr an array command may write ($GODATA_MAX_OUTPUT)")
+	fs.IntVar(&cfg.Retries, "retries", envInt("GODATA_RETRIES", 2), "extra attempts for an array after a timeout or dropped connection ($GODATA_RETRIES)")
+	fs.DurationVar(&cfg.RetryBackoff, "retry-backoff", envDuration("GODATA_RETRY_BACKOFF", 2*time.Second), "wait before the first retry, doubled for every next one ($GODATA_RETRY_BACKOFF)")
+	fs.IntVar(&cfg.BreakerThreshold, "breaker-threshold", envInt("GODATA_BREAKER_THRESHOLD", 3), "auth failures in a row after which an array is skipped, 0 never skips ($GODATA_BREAKER_THRESHOLD)")
+	fs.DurationVar(&cfg.BreakerCoolDown, "breaker-cooldown", envDuration("GODATA_BREAKER_COOLDOWN", 6*time.Hour), "how long an array with too many auth failures is skipped ($GODATA_BREAKER_COOLDOWN)")
+	fs.StringVar(&cfg.BreakerFile, "breaker-file", envString("GODATA_BREAKER_FILE", "breaker.json"), "auth failures per array kept between runs ($GODATA_BREAKER_FILE)")
+	fs.StringVar(&cfg.AuditLog, "audit-log", envString("GODATA_AUDIT_LOG", "audit.log"), "append every command sent to an array to this file, empty to disable ($GODATA_AUDIT_LOG)")
+	fs.StringVar(&cfg.Route, "route", envString("GODATA_ROUTE", ""), "route file with the socks5 proxy and jump hosts of arrays without a route in the inventory ($GODATA_ROUTE)")
+	fs.BoolVar(&cfg.Test, "test", envBool("GODATA_TEST", false), "replay recorded fixtures instead of connecting ($GODATA_TEST)")
+	fs.StringVar(&cfg.Fixtures, "fixtures", envString("GODATA_FIXTURES", "fixtures"), "fixture directory, vendor/model/code-level/command.txt ($GODATA_FIXTURES)")
+	fs.StringVar(&cfg.AlertsFile, "alerts", envString("GODATA_ALERTS", "alerts.json"), "alert configuration, ignored when missing ($GODATA_ALERTS)")
+	fs.BoolVar(&cfg.Forecast, "forecast", envBool("GODATA_FORECAST", true), "forecast days until threshold and full ($GODATA_FORECAST)")
+	fs.IntVar(&cfg.ForecastDays, "forecast-days", envInt("GODATA_FORECAST_DAYS", 90), "days of history used for the forecast ($GODATA_FORECAST_DAYS)")
+	fs.Float64Var(&cfg.ForecastThreshold, "forecast-threshold", envFloat("GODATA_FORECAST_THRESHOLD", 0.9), "used fraction the forecast counts days until ($GODATA_FORECAST_THRESHOLD)")
+	fs.StringVar(&cfg.History, "history", envString("GODATA_HISTORY", "file"), "forecast history source: file, influx or store ($GODATA_HISTORY)")
+	fs.StringVar(&cfg.HistoryFile, "history-file", envString("GODATA_HISTORY_FILE", "history.ndjson"), "local history file, trimmed to -forecast-days ($GODATA_HISTORY_FILE)")
+	fs.StringVar(&cfg.LockDir, "lock-dir", envString("GODATA_LOCK_DIR", os.TempDir()), "directory for run lock files ($GODATA_LOCK_DIR)")
+	fs.StringVar(&cfg.Report, "report", envString("GODATA_REPORT", ""), "write the run report as json to this file ($GODATA_REPORT)")
+	fs.StringVar(&cfg.StateFile, "state-file", envString("GODATA_STATE_FILE", "state.json"), "last known good pools per array ($GODATA_STATE_FILE)")
+	fs.DurationVar(&cfg.StaleMaxAge, "stale-max-age", envDuration("GODATA_STALE_MAX_AGE", 24*time.Hour), "how long last known good pools of a failed array are carried forward ($GODATA_STALE_MAX_AGE)")
+	fs.StringVar(&cfg.Store, "store", envString("GODATA_STORE", ""), "local bbolt file keeping every run, empty to disable ($GODATA_STORE)")
+	fs.DurationVar(&cfg.StoreRaw, "store-raw", envDuration("GODATA_STORE_RAW", 7*24*time.Hour), "runs older than this are thinned to one per day ($GODATA_STORE_RAW)")
+	fs.DurationVar(&cfg.StoreRetention, "store-retention", envDuration("GODATA_STORE_RETENTION", 365*24*time.Hour), "runs older than this are removed, 0 keeps all ($GODATA_STORE_RETENTION)")
+	fs.StringVar(&cfg.LogLevel, "log-level", envString("GODATA_LOG_LEVEL", "info"), "log level: debug, info, warn or error ($GODATA_LOG_LEVEL)")
+	fs.StringVar(&cfg.LogFormat, "log-format", envString("GODATA_LOG_FORMAT", "text"), "log format: text or json ($GODATA_LOG_FORMAT)")
+	fs.StringVar(&cfg.LogOutput, "log-output", envString("GODATA_LOG_OUTPUT", "logs"), "stderr or a directory for daily log files ($GODATA_LOG_OUTPUT)")
+	fs.IntVar(&cfg.LogRetention, "log-retention", envInt("GODATA_LOG_RETENTION", 30), "days of log files to keep, 0 keeps all ($GODATA_LOG_RETENTION)")
+	return fs
+}
+
+// loadBreaker reads the auth failures of earlier runs, starting without any when the file is broken
+func (cfg config) loadBreaker() *collector.Breaker {
+	breaker, err := collector.LoadBreaker(cfg.BreakerFile, cfg.BreakerThreshold, cfg.BreakerCoolDown)
+	if err != nil {
+		logger.Error("loading breaker failed", "phase", "breaker", "error", err)
+		return collector.NewBreaker(cfg.BreakerThreshold, cfg.BreakerCoolDown)
+	}
+	return breaker
+}
+
+// lockedBreaker loads the breaker under the state lock so a file being saved
+// by another run is not read half written
+func (cfg config) lockedBreaker() *collector.Breaker {
+	stateLock, err := waitLock(cfg.LockDir, "state", time.Minute)
+	if err != nil {
+		logger.Error("state lock failed, breaker loaded without it", "phase", "lock", "error", err)
+		return cfg.loadBreaker()
+	}
+	defer stateLock.release()
+	return cfg.loadBreaker()
+}
+
+// newManager returns an ssh connection manager with the command limits of the flags
+func (cfg config) newManager(keep bool) *ssh.Manager {
+	conns := ssh.NewManager(cfg.Username, cfg.Password, keep)
+	conns.CommandTimeout = cfg.CommandTimeout
+	conns.MaxOutput = cfg.MaxOutput
+	conns.Audit = cfg.audit
+	return conns
+}
+
+// replayRoot is the fixture directory in test mode and empty otherwise
+func (cfg config) replayRoot() string {
+	if cfg.Test {
+		return cfg.Fixtures
+	}
+	return ""
+}
+
+// loadInventory loads the inventory and gives the arrays
+// without a route of their own the route of -route
+func (cfg config) loadInventory() ([]model.Array, error) {
+	arrays, err := inventory.Load(cfg.inventorySpec())
+	if err != nil || cfg.Route == "" {
+		return arrays, err
+	}
+	route, err := inventory.LoadRoute(cfg.Route)
+	if err != nil {
+		return arrays, err
+	}
+	inventory.DefaultRoute(arrays, route)
+	return arrays, nil
+}
+
+func (cfg config) inventorySpec() string {
+	if cfg.Inventory != "" {
+		return cfg.Inventory
+	}
+	if cfg.Test {
+		return filepath.Join(cfg.Fixtures, "inventory.json")
+	}
+	return "ibm=IBM.json,huawei=huawei.json"
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	var cfg config
+	var redact bool
+	command := os.Args[1]
+	fs := newFlagSet(command, &cfg)
+	switch command {
+	case "collect", "print", "validate-inventory", "probe":
+		fs.Parse(os.Args[2:])
+	case "daemon":
+		daemonFlags(fs, &cfg)
+		fs.Parse(os.Args[2:])
+	case "history":
+		fs.IntVar(&cfg.HistoryDays, "days", 30, "days of history to show")
+		fs.Parse(os.Args[2:])
+	case "capture":
+		fs.BoolVar(&redact, "redact", true, "replace serials, WWNs, locations and names in the recorded output")
+		fs.Parse(os.Args[2:])
+	case "-h", "-help", "--help", "help":
+		fmt.Print(usage)
+		return
+	default:
+		fmt.Fprint(os.Stderr, "unknown command "+command+"\n\n"+usage)
+		os.Exit(2)
+	}
+
+	if err := setupLogging(cfg.LogLevel, cfg.LogFormat, cfg.LogOutput, cfg.LogRetention); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if err := cfg.checkOutputs(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	// only a daemon with -listen serves /metrics, anywhere else the output would go nowhere
+	if cfg.outputs()["prometheus"] && (command != "daemon" || cfg.Listen == "") {
+		fmt.Fprintln(os.Stderr, "output prometheus needs GoData daemon -listen")
+		os.Exit(2)
+	}
+	// commands reaching arrays must be able to write the audit log before sending anything
+	switch command {
+	case "collect", "print", "probe", "daemon", "capture":
+		if cfg.AuditLog != "" && (!cfg.Test || command == "capture") {
+			cfg.audit = &transport.AuditLog{Filename: cfg.AuditLog}
+			if err := cfg.audit.Check(); err != nil {
+				logger.Error("opening audit log failed", "phase", "audit", "error", err)
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+		}
+	}
+
+	switch command {
+	case "collect":
+		os.Exit(runCollect(cfg))
+	case "print":
+		cfg.Output = "stdout"
+		os.Exit(runCollect(cfg))
+	case "validate-inventory":
+		os.Exit(runValidate(cfg))
+	case "probe":
+		if fs.NArg() != 1 {
+			fmt.Fprint(os.Stderr, "usage: GoData probe [flags] <array>\n")
+			os.Exit(2)
+		}
+		os.Exit(runProbe(cfg, fs.Arg(0)))
+	case "daemon":
+		os.Exit(runDaemon(cfg))
+	case "history":
+		os.Exit(runHistory(cfg, fs.Args()))
+	case "capture":
+		if fs.NArg() != 1 {
+			fmt.Fprint(os.Stderr, "usage: GoData capture [flags] <array>\n")
+			os.Exit(2)
+		}
+		os.Exit(runCapture(cfg, fs.Arg(0), redact))
+	}
+}
+
+func runCollect(cfg config) int {
+	arrays, err := cfg.loadInventory()
+	if err != nil {
+		logger.Error("loading inventory failed", "phase", "inventory", "error", err)
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	arrays = inventory.FilterClient(arrays, cfg.Client)
+
+	selected, locks := lockArrays(cfg.LockDir, arrays)
+	defer locks.release()
+	if len(selected) == 0 && len(arrays) > 0 {
+		logger.Error("run lock failed", "phase", "lock", "error", "every array is being collected elsewhere")
+		fmt.Fprintln(os.Stderr, "every array is being collected elsewhere")
+		return 1
+	}
+	report := runCycle(context.Background(), cfg, arrays, selected, Schedule{Name: "all", Scope: "all"})
+	report.Print(os.Stdout)
+	return exitCode(report)
+}
+
+// runCycle collects the arrays once and writes what belongs to the scope of the schedule:
+// "capacity" for pools and client rollups, "system" for the array inventory or "all".
+// The client rollups cover every array of all, the ones not collected in this cycle
+// with their last known good pools. Cancelling ctx stops the commands in flight,
+// the arrays not collected by then are written as failed
+func runCycle(ctx context.Context, cfg config, all, arrays []model.Array, schedule Schedule) collector.RunReport {
+	scope := schedule.Scope
+	logger.Info("cycle started", "scope", scope, "arrays", len(arrays))
+	started := time.Now()
+	conns := cfg.conns
+	if conns == nil {
+		conns = cfg.newManager(false)
+		defer conns.Close()
+	}
+	breaker := cfg.breaker
+	if breaker == nil {
+		breaker = cfg.lockedBreaker()
+	}
+	results := collector.CollectArrays(ctx, arrays, collector.Options{
+		Concurrency:  cfg.Concurrency,
+		Retries:      cfg.Retries,
+		RetryBackoff: cfg.RetryBackoff,
+		Breaker:      breaker,
+		Connections:  conns,
+		Fixtures:     cfg.replayRoot(),
+	})
+	// overlapping schedules and cron runs read and write the same state files
+	save := !cfg.Test
+	stateLock, err := waitLock(cfg.LockDir, "state", time.Minute)
+	if err != nil {
+		logger.Error("state lock failed, state files are not saved", "phase", "lock", "error", err)
+		save = false
+	}
+	if save {
+		// the file is read again under the lock, other runs may have saved
+		// the failures of their arrays while this one was collecting
+		saved := cfg.loadBreaker()
+		var names []string
+		for _, array := range arrays {
+			names = append(names, array.Name)
+		}
+		saved.Copy(breaker, names)
+		if err := saved.Save(cfg.BreakerFile); err != nil {
+			logger.Error("saving breaker failed", "phase", "breaker", "error", err)
+		}
+	}
+	report := collector.NewRunReport(scope, started, results)
+	if cfg.Report != "" {
+		if err := report.Write(cfg.Report); err != nil {
+			logger.Error("writing report failed", "phase", "report", "error", err)
+		}
+	}
+	var events []model.ChangeEvent
+	rollup := results
+	if scope != "system" {
+		state, err := aggregate.LoadState(cfg.StateFile)
+		if err != nil {
+			logger.Error("loading state failed", "phase", "stale", "error", err)
+		}
+		events = aggregate.DetectChanges(state, results, time.Now())
+		aggregate.LogChanges(events)
+		aggregate.CarryForward(results, state, cfg.StaleMaxAge, time.Now())
+		if save {
+			if err := aggregate.SaveState(cfg.StateFile, state); err != nil {
+				logger.Error("saving state failed", "phase", "stale", "error", err)
+			}
+		}
+		collected := make(map[string]bool)
+		for _, array := range arrays {
+			collected[array.Name] = true
+		}
+		var others []model.Array
+		for _, array := range all {
+			if !collected[array.Name] {
+				others = append(others, array)
+			}
+		}
+		rollup = append(results[:len(results):len(results)], aggregate.StateResults(others, state, cfg.StaleMaxAge, time.Now())...)
+	}
+	if stateLock != nil {
+		stateLock.release()
+	}
+	pools, systems := aggregate.Merge(results)
+	if scope == "system" {
+		pools = model.Pools{}
+	} else if scope == "capacity" {
+		systems = nil
+	}
+	var clients []model.Client
+	if scope != "system" {
+		rollupPools, _ := aggregate.Merge(rollup)
+		for _, name := range aggregate.ClientNames(rollup) {
+			clients = append(clients, aggregate.ClientRollup(name, rollupPools))
+		}
+		aggregate.ApplyCoverage(clients, rollup)
+	}
+
+	now := time.Now()
+	ts := fmt.Sprint(now.UnixNano())
+	outputs := cfg.outputs()
+	if outputs["influx"] {
+		err = output.WriteInflux(cfg.InfluxURL, pools, systems, clients, ts)
+		if err != nil {
+			logger.Error("writing influx failed", "phase", "output", "error", err)
+		}
+		err = output.PostInflux(cfg.InfluxURL, output.TelemetryLines(report, results, ts))
+		if err != nil {
+			logger.Error("writing telemetry failed", "phase", "output", "error", err)
+		}
+		err = output.PostInflux(cfg.InfluxURL, output.ChangeLines(events))
+		if err != nil {
+			logger.Error("writing inventory events failed", "phase", "output", "error", err)
+		}
+	}
+	if outputs["stdout"] {
+		output.PrintResults(pools, systems, clients)
+	}
+	if outputs["json"] || outputs["csv"] || outputs["ndjson"] {
+		err = output.WriteFiles(cfg.OutputDir, outputs, model.Snapshot{Time: now, Pools: pools.Pools, Systems: systems, Clients: clients})
+		if err != nil {
+			logger.Error("writing files failed", "phase", "output", "error", err)
+		}
+	}
+	if cfg.Store != "" && !cfg.Test {
+		store := store.Store{Path: cfg.Store}
+		err = store.Save(model.Snapshot{Time: now, Scope: scope, Schedule: schedule.Name, Pools: pools.Pools, Systems: systems, Clients: clients})
+		if err != nil {
+			logger.Error("saving run to store failed", "phase", "store", "error", err)
+		} else if _, err := store.Compact(cfg.StoreRaw, cfg.StoreRetention, now); err != nil {
+			logger.Error("compacting store failed", "phase", "store", "error", err)
+		}
+	}
+	if outputs["prometheus"] && cfg.exporter != nil {
+		cfg.exporter.Update(scope, results, pools, systems, clients)
+	}
+
+	if scope == "system" {
+		logger.Info("cycle finished", "scope", scope, "status", report.Status)
+		return report
+	}
+
+	if cfg.Forecast {
+		var history forecast.HistorySource = forecast.FileHistory{Filename: cfg.HistoryFile}
+		if cfg.History == "store" {
+			history = store.Store{Path: cfg.Store}
+		} else if cfg.History == "influx" {
+			history, err = forecast.InfluxHistoryFromWriteURL(cfg.InfluxURL)
+			if err != nil {
+				logger.Error("influx history failed", "phase", "forecast", "error", err)
+			}
+		} else if !cfg.Test {
+			appendHistory(cfg, pools, time.Now())
+		}
+		samples, err := history.Samples(time.Now().AddDate(0, 0, -cfg.ForecastDays))
+		if err != nil {
+			logger.Error("reading history failed", "phase", "forecast", "error", err)
+		}
+		poolForecasts, rollupForecasts := forecast.Compute(samples, cfg.ForecastThreshold)
+		if outputs["stdout"] {
+			forecast.Print(poolForecasts, rollupForecasts)
+		}
+		if outputs["influx"] {
+			err = forecast.Write(cfg.InfluxURL, poolForecasts, rollupForecasts, ts)
+			if err != nil {
+				logger.Error("writing forecast failed", "phase", "forecast", "error", err)
+			}
+		}
+	}
+
+	if _, err := os.Stat(cfg.AlertsFile); err == nil && !cfg.Test {
+		// the alert state is read and written like the other state files
+		if alertsLock, err := waitLock(cfg.LockDir, "state", time.Minute); err != nil {
+			logger.Error("state lock failed, alerts are not checked", "phase", "lock", "error", err)
+		} else {
+			err = alerts.Check(pools, cfg.AlertsFile)
+			alertsLock.release()
+			if err != nil {
+				logger.Error("checking alerts failed", "phase", "alerts", "error", err)
+			}
+		}
+	}
+
+	unhealthy := model.UnhealthyPools(pools)
+	if len(unhealthy.Pools) > 0 {
+		fmt.Println("Unhealthy pools, capacity numbers may not be reliable:")
+		for _, pool := range unhealthy.Pools {
+			fmt.Println(" " + pool.ArrayName + " " + pool.PoolName + " health=" + pool.Health + " running=" + pool.RunningStatus)
+			logger.Warn("unhealthy pool", "array", pool.ArrayName, "pool", pool.PoolName, "health", pool.Health, "running", pool.RunningStatus)
+		}
+	}
+	logger.Info("cycle finished", "scope", scope, "status", report.Status)
+	return report
+}
+
+// appendHistory adds the pools of this run to the history file and drops the samples
+// older than the forecast window, under the lock of the other state files
+func appendHistory(cfg config, pools model.Pools, now time.Time) {
+	lock, err := waitLock(cfg.LockDir, "state", time.Minute)
+	if err != nil {
+		logger.Error("state lock failed, history is not appended", "phase", "lock", "error", err)
+		return
+	}
+	defer lock.release()
+	history := forecast.FileHistory{Filename: cfg.HistoryFile}
+	if err := history.Append(pools, now); err != nil {
+		logger.Error("appending history failed", "phase", "forecast", "error", err)
+		return
+	}
+	if err := history.Trim(now.AddDate(0, 0, -cfg.ForecastDays)); err != nil {
+		logger.Error("trimming history failed", "phase", "forecast", "error", err)
+	}
+}
+
+func runValidate(cfg config) int {
+	arrays, err := cfg.loadInventory()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	problems := inventory.Validate(arrays)
+	for _, problem := range problems {
+		fmt.Println(problem)
+	}
+	if len(problems) > 0 {
+		return 1
+	}
+	fmt.Println(strconv.Itoa(len(arrays)) + " arrays ok")
+	return 0
+}
+
+func runProbe(cfg config, name string) int {
+	arrays, err := cfg.loadInventory()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	for _, array := range arrays {
+		if array.Name != name {
+			continue
+		}
+		conns := cfg.newManager(false)
+		defer conns.Close()
+		runner, err := collector.ArrayRunner(array, conns, cfg.replayRoot())
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if runner == nil {
+			client, err := conns.Get(context.Background(), ssh.TargetOf(array))
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+			defer conns.Release(array.Ip, client, false)
+			runner = conns.Runner(client)
+		}
+		pools, system, _, err := collector.CollectArray(context.Background(), conns, ssh.TargetOf(array), printRunner{runner}, array.Name, array.Site, array.Type, array.Client, array.Model)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		fmt.Println()
+		var systems []model.System
+		if system.Vendor != "" {
+			systems = append(systems, system)
+		}
+		output.PrintResults(pools, systems, nil)
+		if len(pools.Pools) == 0 {
+			return 1
+		}
+		return 0
+	}
+	fmt.Fprintln(os.Stderr, "array "+name+" not found in inventory")
+	return 1
+}
+
+// printRunner prints the raw output of every command it runs, before it is parsed
+type printRunner struct {
+	runner transport.Runner
+}
+
+func (r printRunner) Run(ctx context.Context, command string) ([]byte, []byte, error) {
+	stdout, stderr, err := r.runner.Run(ctx, command)
+	fmt.Println("$ " + command)
+	os.Stdout.Write(stdout)
+	if len(stderr) > 0 {
+		fmt.Fprintln(os.Stderr, strings.TrimSpace(string(stderr)))
+	}
+	return stdout, stderr, err
+}
+
+// exit codes of collect, 1 and 2 are left for fatal and usage errors
+const (
+	exitSuccess        = 0
+	exitPartialFailure = 3
+	exitTotalFailure   = 4
+)
+
+func exitCode(report collector.RunReport) int {
+	switch report.Status {
+	case "partial":
+		return exitPartialFailure
+	case "failure":
+		return exitTotalFailure
+	}
+	return exitSuccess
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"dataCollection/collector"
+	"dataCollection/internal/fakeinflux"
+	"dataCollection/internal/fakeontap"
+	"dataCollection/model"
+	"dataCollection/transport"
+	"dataCollection/transport/ssh"
+	"dataCollection/vendors"
+)
+
+// restScenario is one way the REST api of an array can behave, played by the fake cluster
+type restScenario struct {
+	Name     string
+	Password string
+	// Status and Delay change the answer to the data command, Pages splits
+	// its records over that many pages linked by _links.next
+	Status int
+	Delay  time.Duration
+	Pages  int
+	// CommandTimeout overrides the request timeout
+	CommandTimeout time.Duration
+	// Untrusted leaves out the ca_file of the server certificate, Down closes the server
+	Untrusted bool
+	Down      bool
+	// Runs collects this many times with a breaker opening after Breaker auth failures
+	Runs    int
+	Breaker int
+	Want    string
+}
+
+var restScenarios = []restScenario{
+	{Name: "rest", Password: testPassword, Want: collector.ClassOK},
+	{Name: "rest paginated", Password: testPassword, Pages: 3, Want: collector.ClassOK},
+	{Name: "rest wrong password", Password: "wrong", Want: collector.ClassAuthFailure},
+	{Name: "rest server error", Password: testPassword, Status: 500, Want: collector.ClassCommandError},
+	{Name: "rest hung request", Password: testPassword, Delay: 3 * time.Second, CommandTimeout: time.Second, Want: collector.ClassCommandTimeout},
+	{Name: "rest untrusted certificate", Password: testPassword, Untrusted: true, Want: collector.ClassDialError},
+	{Name: "rest circuit breaker", Password: "wrong", Runs: 2, Breaker: 1, Want: collector.ClassCircuitOpen},
+	{Name: "rest unreachable", Password: testPassword, Down: true, Want: collector.ClassDialError},
+}
+
+// runRESTScenario collects an array with transport rest from the fake cluster, checking
+// the error class, that only GET requests of the api paths were sent and the audit records
+func runRESTScenario(array model.Array, dir string, commands []string, scenario restScenario, sink *fakeinflux.Sink, audit *transport.AuditLog) (got string, requests int, problem string) {
+	server := fakeontap.New(testUser, testPassword)
+	defer server.Close()
+	paths := vendors.RESTPaths[array.Model]
+	var listing []byte
+	for _, command := range commands {
+		body, _, err := transport.Replay{Dir: dir}.Run(context.Background(), command)
+		if err != nil {
+			return "", 0, err.Error()
+		}
+		path := strings.SplitN(paths[command], "?", 2)[0]
+		response := fakeontap.Response{Body: string(body)}
+		if command == commands[0] {
+			listing = body
+			response.Status, response.Delay = scenario.Status, scenario.Delay
+			if scenario.Pages > 1 {
+				pages, err := splitPages(body, path, scenario.Pages)
+				if err != nil {
+					return "", 0, err.Error()
+				}
+				for i, page := range pages[1:] {
+					server.Handle(path+"?start="+strconv.Itoa(i+1), fakeontap.Response{Body: page})
+				}
+				response.Body = pages[0]
+			}
+		}
+		server.Handle(path, response)
+	}
+
+	array.Ip = server.Addr()
+	array.REST = &model.RESTOptions{}
+	if !scenario.Untrusted {
+		ca, err := ioutil.TempFile("", "godata-test-*.pem")
+		if err != nil {
+			return "", 0, err.Error()
+		}
+		defer os.Remove(ca.Name())
+		ca.Write(server.CertificatePEM())
+		ca.Close()
+		array.REST.CAFile = ca.Name()
+	}
+	if scenario.Down {
+		server.Close()
+	}
+
+	runs := scenario.Runs
+	if runs < 1 {
+		runs = 1
+	}
+	conns := ssh.NewManager(testUser, scenario.Password, false)
+	conns.CommandTimeout = scenario.CommandTimeout
+	conns.Audit = audit
+	defer conns.Close()
+	options := collector.Options{Connections: conns}
+	if scenario.Breaker > 0 {
+		options.Breaker = collector.NewBreaker(scenario.Breaker, time.Hour)
+	}
+	audited := len(readAudit(audit))
+	var result model.ArrayResult
+	for run := 0; run < runs; run++ {
+		result = collector.CollectArrays(context.Background(), []model.Array{array}, options)[0]
+		if result.Err != nil && options.Breaker == nil {
+			break
+		}
+	}
+	got = collector.ErrorClass(result.Err)
+	sent := server.Requests()
+	requests = len(sent)
+	if got != scenario.Want {
+		return got, requests, "error class " + got
+	}
+	for _, request := range sent {
+		if !strings.HasPrefix(request, "GET /api/") {
+			return got, requests, "request " + request
+		}
+	}
+	// every command is audited, also the ones that never got an answer, and
+	// after a refused login or connection the next command is not tried
+	records := readAudit(audit)[audited:]
+	want := result.Attempts * len(commands)
+	switch got {
+	case collector.ClassAuthFailure, collector.ClassDialError:
+		want = result.Attempts
+	case collector.ClassCircuitOpen:
+		// the logins refused before the breaker opened
+		want = scenario.Breaker
+	}
+	if len(records) != want {
+		return got, requests, strconv.Itoa(len(records)) + " audit records, expected " + strconv.Itoa(want)
+	}
+	for _, record := range records {
+		if record.Array != array.Name || record.User != testUser || record.Host != array.Ip {
+			return got, requests, "audit record of " + record.User + "@" + record.Array + " (" + record.Host + ")"
+		}
+	}
+	if scenario.Breaker > 0 && requests != scenario.Breaker {
+		return got, requests, strconv.Itoa(requests) + " requests while the breaker was open, expected " + strconv.Itoa(scenario.Breaker)
+	}
+	if result.Err != nil {
+		return got, requests, ""
+	}
+	wantRequests := len(commands)
+	if scenario.Pages > 1 {
+		wantRequests += scenario.Pages - 1
+	}
+	if requests != wantRequests {
+		return got, requests, "expected " + strconv.Itoa(wantRequests) + " requests"
+	}
+	if len(result.Pools.Pools) == 0 {
+		return got, requests, "no pools parsed"
+	}
+	if scenario.Pages > 1 {
+		if want, err := vendors.ParsePools(listing, nil, array.Model, array.Name, array.Site, array.Type, array.Client); err != nil || len(result.Pools.Pools) != len(want.Pools) {
+			return got, requests, strconv.Itoa(len(result.Pools.Pools)) + " pools parsed from " + strconv.Itoa(scenario.Pages) + " pages, expected " + strconv.Itoa(len(want.Pools))
+		}
+	}
+	return got, requests, checkInflux(sink, array, result.Pools, result.System)
+}
+
+// splitPages spreads the records of a listing over pages as ONTAP does when a listing
+// is longer than max_records, every page but the last links to the next one
+func splitPages(listing []byte, path string, pages int) ([]string, error) {
+	var all struct {
+		Records []json.RawMessage `json:"records"`
+	}
+	if err := json.Unmarshal(listing, &all); err != nil {
+		return nil, err
+	}
+	size := (len(all.Records) + pages - 1) / pages
+	var output []string
+	for i := 0; i < pages; i++ {
+		start, end := i*size, (i+1)*size
+		if start > len(all.Records) {
+			start = len(all.Records)
+		}
+		if end > len(all.Records) {
+			end = len(all.Records)
+		}
+		page := map[string]interface{}{"records": all.Records[start:end], "num_records": end - start}
+		if i < pages-1 {
+			page["_links"] = map[string]interface{}{"next": map[string]string{"href": path + "?start=" + strconv.Itoa(i+1)}}
+		}
+		byteValue, err := json.Marshal(page)
+		if err != nil {
+			return nil, err
+		}
+		output = append(output, string(byteValue))
+	}
+	return output, nil
+}
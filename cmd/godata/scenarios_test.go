@@ -0,0 +1,402 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"dataCollection/aggregate"
+	"dataCollection/collector"
+	"dataCollection/internal/fakeinflux"
+	"dataCollection/internal/fakesocks"
+	"dataCollection/internal/fakessh"
+	"dataCollection/inventory"
+	"dataCollection/model"
+	"dataCollection/output"
+	"dataCollection/transport"
+	"dataCollection/transport/ssh"
+	"dataCollection/vendors"
+)
+
+// sshScenario is one way an array can behave, played by the fake ssh server
+type sshScenario struct {
+	Name     string
+	Auth     fakessh.AuthMode
+	Password string
+	// Script changes the fixture responses before collecting
+	Script func(server *fakessh.Server, commands []string, outputs map[string][]byte)
+	// Down closes the server before collecting
+	Down bool
+	// Via is the route to the server: "jump", "socks5", "socks5+jump" or direct when empty
+	Via string
+	// Runs collects this many times through one manager keeping the connection
+	Runs int
+	// CommandTimeout and MaxOutput override the command limits
+	CommandTimeout time.Duration
+	MaxOutput      int
+	// Legacy limits the server to old algorithms, SSH are the array ssh settings
+	Legacy bool
+	SSH    *model.SSHOptions
+	// PortSetting moves the server port from the ip to the ssh port setting
+	PortSetting bool
+	// Drop closes the first connections, Retries are the attempts left after one
+	// fails and Breaker opens the circuit breaker after that many auth failures
+	Drop    int
+	Retries int
+	Breaker int
+	// Attempts is checked on the last run when set
+	Attempts int
+	Want     string
+}
+
+// legacySSH are the settings of an array that only offers legacy algorithms
+var legacySSH = &model.SSHOptions{
+	KeyExchanges:  []string{"diffie-hellman-group1-sha1"},
+	Ciphers:       []string{"aes128-cbc"},
+	MACs:          []string{"hmac-sha1"},
+	DialTimeout:   "5s",
+	ClientVersion: "SSH-2.0-GoData",
+}
+
+const (
+	testUser     = "godata"
+	testPassword = "secret"
+)
+
+var sshScenarios = []sshScenario{
+	{Name: "password", Auth: fakessh.AuthPassword, Password: testPassword, Want: collector.ClassOK},
+	{Name: "keyboard-interactive fallback", Auth: fakessh.AuthKeyboardInteractive, Password: testPassword, Want: collector.ClassOK},
+	{Name: "key only", Auth: fakessh.AuthKey, Password: testPassword, Want: collector.ClassAuthFailure},
+	{Name: "wrong password", Auth: fakessh.AuthPassword, Password: "wrong", Want: collector.ClassAuthFailure},
+	{Name: "failing command", Auth: fakessh.AuthPassword, Password: testPassword, Want: collector.ClassCommandError,
+		Script: func(server *fakessh.Server, commands []string, outputs map[string][]byte) {
+			server.Handle(commands[0], fakessh.Response{Stderr: "CMMVC5786E The action failed because the cluster is not in a stable state.\n", ExitStatus: 1})
+		}},
+	{Name: "slow command", Auth: fakessh.AuthPassword, Password: testPassword, Want: collector.ClassOK,
+		Script: func(server *fakessh.Server, commands []string, outputs map[string][]byte) {
+			server.Handle(commands[0], fakessh.Response{Stdout: string(outputs[commands[0]]), Delay: 2 * time.Second})
+		}},
+	{Name: "hung command", Auth: fakessh.AuthPassword, Password: testPassword, CommandTimeout: time.Second, Want: collector.ClassCommandTimeout,
+		Script: func(server *fakessh.Server, commands []string, outputs map[string][]byte) {
+			server.Handle(commands[0], fakessh.Response{Stdout: string(outputs[commands[0]]), Delay: 3 * time.Second})
+		}},
+	{Name: "runaway output", Auth: fakessh.AuthPassword, Password: testPassword, MaxOutput: 64 << 10, Want: collector.ClassCommandError,
+		Script: func(server *fakessh.Server, commands []string, outputs map[string][]byte) {
+			server.Handle(commands[0], fakessh.Response{Stdout: strings.Repeat(string(outputs[commands[0]]), 1<<20/len(outputs[commands[0]])+1)})
+		}},
+	{Name: "warning on stderr", Auth: fakessh.AuthPassword, Password: testPassword, Want: collector.ClassOK,
+		Script: func(server *fakessh.Server, commands []string, outputs map[string][]byte) {
+			server.Handle(commands[0], fakessh.Response{Stdout: string(outputs[commands[0]]), Stderr: "WARNING: the cli session will expire in 5 minutes\n"})
+		}},
+	{Name: "reused connection", Auth: fakessh.AuthKeyboardInteractive, Password: testPassword, Runs: 3, Want: collector.ClassOK},
+	{Name: "jump host", Auth: fakessh.AuthPassword, Password: testPassword, Via: "jump", Want: collector.ClassOK},
+	{Name: "socks5 proxy", Auth: fakessh.AuthPassword, Password: testPassword, Via: "socks5", Want: collector.ClassOK},
+	{Name: "socks5 and jump host", Auth: fakessh.AuthKeyboardInteractive, Password: testPassword, Via: "socks5+jump", Want: collector.ClassOK},
+	{Name: "legacy algorithms", Auth: fakessh.AuthPassword, Password: testPassword, Legacy: true, SSH: legacySSH, Want: collector.ClassOK},
+	{Name: "legacy without settings", Auth: fakessh.AuthPassword, Password: testPassword, Legacy: true, Want: collector.ClassDialError},
+	{Name: "port setting", Auth: fakessh.AuthPassword, Password: testPassword, PortSetting: true, Want: collector.ClassOK},
+	{Name: "dropped connection", Auth: fakessh.AuthPassword, Password: testPassword, Drop: 1, Retries: 2, Attempts: 2, Want: collector.ClassOK},
+	{Name: "dropped without retries", Auth: fakessh.AuthPassword, Password: testPassword, Drop: 1, Attempts: 1, Want: collector.ClassDialError},
+	{Name: "auth failure not retried", Auth: fakessh.AuthPassword, Password: "wrong", Retries: 2, Attempts: 1, Want: collector.ClassAuthFailure},
+	{Name: "circuit breaker", Auth: fakessh.AuthPassword, Password: "wrong", Runs: 2, Breaker: 1, Attempts: 0, Want: collector.ClassCircuitOpen},
+	{Name: "unreachable", Auth: fakessh.AuthPassword, Password: testPassword, Down: true, Want: collector.ClassDialError},
+}
+
+// deniedCommands must never reach an array: writes, shell pipes and chained commands
+var deniedCommands = map[string][]string{
+	"ibm":    {"svctask rmmdiskgrp -force 0", "lssystem -delim ,| grep -i code", "lsmdiskgrp; chsystem -name x"},
+	"huawei": {"delete storage_pool general pool_id=0", "show system general | grep Version", "change user_mgt offline_user user_name=admin"},
+	"ontap":  {"storage aggregate delete -aggregate aggr1", "version; system node reboot -node *", "set -privilege diagnostic"},
+}
+
+// TestScenarios collects every fixture array through the fake ssh server in every
+// scenario and writes the results to a fake influx, checking the error class,
+// the sessions and handshakes used and the lines written
+func TestScenarios(t *testing.T) {
+	if testing.Short() {
+		t.Skip("scenarios wait for slow and hung commands")
+	}
+	fixtures := filepath.Join("..", "..", "fixtures")
+	arrays, err := inventory.Load(filepath.Join(fixtures, "inventory.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink := fakeinflux.New()
+	defer sink.Close()
+	audit := &transport.AuditLog{Filename: filepath.Join(t.TempDir(), "audit.log")}
+
+	check := func(t *testing.T, want, got string, sessions int, problem string) {
+		if problem != "" {
+			t.Errorf("want %s, got %s after %d sessions: %s", want, got, sessions, problem)
+		}
+	}
+	for _, array := range arrays {
+		dir, err := collector.FixtureDir(fixtures, array)
+		if err != nil {
+			t.Fatal(err)
+		}
+		commands := []string{vendors.Commands[array.Model].Data, vendors.Commands[array.Model].Firmware}
+		if array.Transport == model.TransportREST {
+			// sessions are the api requests here
+			for _, scenario := range restScenarios {
+				t.Run(array.Name+"/"+scenario.Name, func(t *testing.T) {
+					got, requests, problem := runRESTScenario(array, dir, commands, scenario, sink, audit)
+					check(t, scenario.Want, got, requests, problem)
+				})
+			}
+			continue
+		}
+		for _, scenario := range sshScenarios {
+			t.Run(array.Name+"/"+scenario.Name, func(t *testing.T) {
+				got, sessions, problem := runScenario(array, dir, commands, scenario, sink, audit)
+				check(t, scenario.Want, got, sessions, problem)
+			})
+		}
+		for _, command := range deniedCommands[array.Model] {
+			t.Run(array.Name+"/denied: "+command, func(t *testing.T) {
+				got, sessions, problem := runDenied(array, command, audit)
+				check(t, collector.ClassCommandDenied, got, sessions, problem)
+			})
+		}
+	}
+}
+
+func runScenario(array model.Array, dir string, commands []string, scenario sshScenario, sink *fakeinflux.Sink, audit *transport.AuditLog) (got string, sessions int, problem string) {
+	var options []fakessh.Option
+	if scenario.Legacy {
+		options = append(options, fakessh.Algorithms(legacySSH.KeyExchanges, legacySSH.Ciphers, legacySSH.MACs))
+	}
+	server, err := fakessh.New(testUser, testPassword, scenario.Auth, options...)
+	if err != nil {
+		return "", 0, err.Error()
+	}
+	defer server.Close()
+	outputs := make(map[string][]byte)
+	for _, command := range commands {
+		output, _, err := transport.Replay{Dir: dir}.Run(context.Background(), command)
+		if err != nil {
+			return "", 0, err.Error()
+		}
+		outputs[command] = output
+		server.Handle(command, fakessh.Response{Stdout: string(output)})
+	}
+	if scenario.Script != nil {
+		scenario.Script(server, commands, outputs)
+	}
+	server.Drop(scenario.Drop)
+	if scenario.Down {
+		server.Close()
+	}
+
+	route, routeCheck, err := testRoute(scenario.Via)
+	if err != nil {
+		return "", 0, err.Error()
+	}
+	defer routeCheck(true)
+
+	target := ssh.Target{Host: server.Addr(), Route: route, Options: scenario.SSH}
+	if scenario.PortSetting {
+		host, port, _ := net.SplitHostPort(server.Addr())
+		number, _ := strconv.Atoi(port)
+		target.Host = host
+		target.Options = &model.SSHOptions{Port: number}
+	}
+
+	runs := scenario.Runs
+	if runs < 1 {
+		runs = 1
+	}
+	conns := ssh.NewManager(testUser, scenario.Password, runs > 1)
+	conns.CommandTimeout = scenario.CommandTimeout
+	conns.MaxOutput = scenario.MaxOutput
+	conns.Audit = audit
+	defer conns.Close()
+	audited := len(readAudit(audit))
+	collectOptions := collector.Options{Connections: conns, Retries: scenario.Retries, RetryBackoff: 10 * time.Millisecond}
+	if scenario.Breaker > 0 {
+		collectOptions.Breaker = collector.NewBreaker(scenario.Breaker, time.Hour)
+	}
+	array.Ip, array.Route, array.SSH = target.Host, target.Route, target.Options
+	var result model.ArrayResult
+	for run := 0; run < runs; run++ {
+		result = collector.CollectArrays(context.Background(), []model.Array{array}, collectOptions)[0]
+		if result.Err != nil && collectOptions.Breaker == nil {
+			break
+		}
+	}
+	pools, system, err := result.Pools, result.System, result.Err
+	got = collector.ErrorClass(err)
+	sessions = server.Sessions()
+	if got != scenario.Want {
+		return got, sessions, "error class " + got
+	}
+	if (scenario.Attempts > 0 || collectOptions.Breaker != nil) && result.Attempts != scenario.Attempts {
+		return got, sessions, strconv.Itoa(result.Attempts) + " attempts, expected " + strconv.Itoa(scenario.Attempts)
+	}
+	if dropped := server.Dropped(); dropped != scenario.Drop && !scenario.Down {
+		return got, sessions, strconv.Itoa(dropped) + " connections dropped, expected " + strconv.Itoa(scenario.Drop)
+	}
+	// every command sent is one session and one audit record
+	records := readAudit(audit)[audited:]
+	if len(records) != sessions {
+		return got, sessions, strconv.Itoa(len(records)) + " audit records for " + strconv.Itoa(sessions) + " sessions"
+	}
+	for _, record := range records {
+		if record.Array != array.Name || record.User != testUser || record.Host != target.Host {
+			return got, sessions, "audit record of " + record.User + "@" + record.Array + " (" + record.Host + ")"
+		}
+		if (record.Status == transport.AuditOK) != (record.ExitStatus == 0 && record.Error == "") {
+			return got, sessions, "audit record with status " + record.Status + " and exit status " + strconv.Itoa(record.ExitStatus)
+		}
+	}
+	if collectOptions.Breaker != nil && server.Handshakes() != scenario.Breaker {
+		return got, sessions, strconv.Itoa(server.Handshakes()) + " ssh handshakes while the breaker was open, expected " + strconv.Itoa(scenario.Breaker)
+	}
+	if err != nil {
+		return got, sessions, ""
+	}
+	if sessions != runs*len(commands) {
+		return got, sessions, "expected " + strconv.Itoa(runs*len(commands)) + " sessions"
+	}
+	if handshakes := server.Handshakes(); handshakes != 1 {
+		return got, sessions, strconv.Itoa(handshakes) + " ssh handshakes, expected 1"
+	}
+	if scenario.SSH != nil && scenario.SSH.ClientVersion != "" {
+		if versions := server.ClientVersions(); len(versions) != 1 || versions[0] != scenario.SSH.ClientVersion {
+			return got, sessions, "client versions " + strings.Join(versions, ", ")
+		}
+	}
+	if problem := routeCheck(false); problem != "" {
+		return got, sessions, problem
+	}
+	if len(pools.Pools) == 0 {
+		return got, sessions, "no pools parsed"
+	}
+	return got, sessions, checkInflux(sink, array, pools, system)
+}
+
+// checkInflux writes the parsed pools to the fake influx, where they have to arrive as one testData line each
+func checkInflux(sink *fakeinflux.Sink, array model.Array, pools model.Pools, system model.System) string {
+	before := len(sink.Measurement("testData"))
+	err := output.WriteInflux(sink.URL("test"), pools, []model.System{system}, []model.Client{aggregate.ClientRollup(array.Client, pools)}, fmt.Sprint(time.Now().UnixNano()))
+	if err != nil {
+		return "influx: " + err.Error()
+	}
+	if written := len(sink.Measurement("testData")) - before; written != len(pools.Pools) {
+		return strconv.Itoa(written) + " testData lines for " + strconv.Itoa(len(pools.Pools)) + " pools"
+	}
+	return ""
+}
+
+// runDenied sends a command that is not on the allowlist through a logged in
+// connection and checks it never reaches the server and is audited as denied
+func runDenied(array model.Array, command string, audit *transport.AuditLog) (got string, sessions int, problem string) {
+	server, err := fakessh.New(testUser, testPassword, fakessh.AuthPassword)
+	if err != nil {
+		return "", 0, err.Error()
+	}
+	defer server.Close()
+	server.Handle(command, fakessh.Response{Stdout: "done\n"})
+	conns := ssh.NewManager(testUser, testPassword, false)
+	conns.Audit = audit
+	defer conns.Close()
+	target := ssh.Target{Host: server.Addr()}
+	client, err := conns.Get(context.Background(), target)
+	if err != nil {
+		return collector.ClassDialError, 0, err.Error()
+	}
+	defer conns.Release(target.Host, client, false)
+	runner := transport.Guard{
+		Runner: conns.Runner(client),
+		Allow:  func(command string) error { return vendors.Allowed(array.Model, command) },
+		Audit:  audit,
+		Array:  array.Name,
+		Host:   target.Host,
+		User:   testUser,
+	}
+	audited := len(readAudit(audit))
+	_, _, err = runner.Run(context.Background(), command)
+	got = collector.ClassOK
+	if errors.Is(err, transport.ErrNotAllowed) {
+		got = collector.ClassCommandDenied
+	}
+	sessions = server.Sessions()
+	if got != collector.ClassCommandDenied {
+		return got, sessions, "command was not refused"
+	}
+	if sessions != 0 || len(server.Commands()) != 0 {
+		return got, sessions, "command reached the server"
+	}
+	if records := readAudit(audit)[audited:]; len(records) != 1 || records[0].Status != transport.AuditDenied || records[0].Command != command {
+		return got, sessions, "no denied audit record"
+	}
+	return got, sessions, ""
+}
+
+// readAudit returns the records of how every command ended, the tests only append
+// so the records of a scenario are the ones after the count taken before it
+func readAudit(audit *transport.AuditLog) []transport.AuditRecord {
+	var records []transport.AuditRecord
+	byteValue, _ := ioutil.ReadFile(audit.Filename)
+	for _, line := range strings.Split(string(byteValue), "\n") {
+		var record transport.AuditRecord
+		// the started record of a command is followed by the one of how it ended
+		if json.Unmarshal([]byte(line), &record) == nil && record.Status != transport.AuditStarted {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+// testRoute starts the jump host and socks5 proxy of via and returns the route
+// through them. check reports how they were used, with stop it closes them
+func testRoute(via string) (route *model.Route, check func(stop bool) string, err error) {
+	var jump *fakessh.Server
+	var proxy *fakesocks.Proxy
+	check = func(stop bool) string {
+		if stop {
+			if jump != nil {
+				jump.Close()
+			}
+			if proxy != nil {
+				proxy.Close()
+			}
+			return ""
+		}
+		if jump != nil && (jump.Connections() != 1 || jump.Forwards() != 1) {
+			return "jump host: " + strconv.Itoa(jump.Connections()) + " logins and " + strconv.Itoa(jump.Forwards()) + " forwards, expected 1"
+		}
+		if proxy != nil && proxy.Connects() != 1 {
+			return "socks5: " + strconv.Itoa(proxy.Connects()) + " connects, expected 1"
+		}
+		return ""
+	}
+	if via == "" {
+		return nil, check, nil
+	}
+	route = &model.Route{}
+	if strings.Contains(via, "socks5") {
+		proxy, err = fakesocks.New("proxy", "proxy-secret")
+		if err != nil {
+			return nil, check, err
+		}
+		route.SOCKS5 = "socks5://proxy:proxy-secret@" + proxy.Addr()
+	}
+	if strings.Contains(via, "jump") {
+		jump, err = fakessh.New("jump", "jump-secret", fakessh.AuthPassword)
+		if err != nil {
+			check(true)
+			return nil, check, err
+		}
+		route.Jump = []model.JumpHost{{Host: jump.Addr(), User: "jump", Password: "jump-secret"}}
+	}
+	return route, check, nil
+}
@@ -0,0 +1,131 @@
+package collector
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// circuit breaker states of an array in the run report
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+)
+
+// Breaker stops collecting an array after Threshold auth failures in a row
+// until CoolDown has passed, so an expired password does not lock the service
+// account. After the cool-down one attempt is let through, another auth
+// failure opens the breaker again and a success closes it
+type Breaker struct {
+	Threshold int
+	CoolDown  time.Duration
+
+	mu     sync.Mutex
+	arrays map[string]BreakerState
+}
+
+// BreakerState struct which contains the auth
+// failures in a row of one array, kept between runs
+type BreakerState struct {
+	AuthFailures int       `json:"auth_failures"`
+	OpenedAt     time.Time `json:"opened_at,omitempty"`
+}
+
+// NewBreaker returns a breaker without any failures, a threshold below 1 never opens
+func NewBreaker(threshold int, coolDown time.Duration) *Breaker {
+	return &Breaker{Threshold: threshold, CoolDown: coolDown, arrays: make(map[string]BreakerState)}
+}
+
+// LoadBreaker reads the failures saved by an earlier run, a missing file is no failures
+func LoadBreaker(filename string, threshold int, coolDown time.Duration) (*Breaker, error) {
+	breaker := NewBreaker(threshold, coolDown)
+	byteValue, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return breaker, nil
+	}
+	if err != nil {
+		return breaker, err
+	}
+	if err := json.Unmarshal(byteValue, &breaker.arrays); err != nil {
+		return breaker, err
+	}
+	return breaker, nil
+}
+
+// Save writes the failures of every array so the next run continues them,
+// the lock is held while writing so cycles sharing a breaker do not mix their files
+func (b *Breaker) Save(filename string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	byteValue, err := json.MarshalIndent(b.arrays, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, byteValue, 0644)
+}
+
+// Copy takes the failures of the arrays from other, a run that collected only those
+// arrays merges its outcome into the file of runs that collected others meanwhile
+func (b *Breaker) Copy(other *Breaker, arrays []string) {
+	if b == other {
+		return
+	}
+	other.mu.Lock()
+	states := make(map[string]BreakerState)
+	for _, array := range arrays {
+		if state, ok := other.arrays[array]; ok {
+			states[array] = state
+		}
+	}
+	other.mu.Unlock()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, array := range arrays {
+		if state, ok := states[array]; ok {
+			b.arrays[array] = state
+		} else {
+			delete(b.arrays, array)
+		}
+	}
+}
+
+// State is the breaker state of an array at now
+func (b *Breaker) State(array string, now time.Time) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state(array, now)
+}
+
+func (b *Breaker) state(array string, now time.Time) string {
+	state := b.arrays[array]
+	if b.Threshold < 1 || state.AuthFailures < b.Threshold {
+		return BreakerClosed
+	}
+	if now.Sub(state.OpenedAt) < b.CoolDown {
+		return BreakerOpen
+	}
+	return BreakerHalfOpen
+}
+
+// Record counts the outcome of collecting an array. Auth failures open the
+// breaker, a success closes it and other errors say nothing about the login
+func (b *Breaker) Record(array, class string, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if class == ClassOK {
+		delete(b.arrays, array)
+		return
+	}
+	if class != ClassAuthFailure {
+		return
+	}
+	state := b.arrays[array]
+	state.AuthFailures++
+	if b.Threshold > 0 && state.AuthFailures >= b.Threshold {
+		state.OpenedAt = now
+	}
+	b.arrays[array] = state
+}
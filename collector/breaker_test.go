@@ -0,0 +1,128 @@
+package collector
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var now = time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+func TestBreaker(t *testing.T) {
+	type step struct {
+		class string
+		after time.Duration
+		want  string
+	}
+	tests := []struct {
+		name      string
+		threshold int
+		steps     []step
+	}{
+		{
+			name:      "opens at the threshold",
+			threshold: 2,
+			steps: []step{
+				{class: ClassAuthFailure, want: BreakerClosed},
+				{class: ClassAuthFailure, want: BreakerOpen},
+				{after: 59 * time.Minute, want: BreakerOpen},
+			},
+		},
+		{
+			name:      "half-open after the cool-down and closed by a success",
+			threshold: 1,
+			steps: []step{
+				{class: ClassAuthFailure, want: BreakerOpen},
+				{after: time.Hour, want: BreakerHalfOpen},
+				{class: ClassOK, want: BreakerClosed},
+			},
+		},
+		{
+			name:      "half-open opened again by an auth failure",
+			threshold: 1,
+			steps: []step{
+				{class: ClassAuthFailure, want: BreakerOpen},
+				{after: time.Hour, want: BreakerHalfOpen},
+				{class: ClassAuthFailure, want: BreakerOpen},
+			},
+		},
+		{
+			name:      "other errors say nothing about the login",
+			threshold: 2,
+			steps: []step{
+				{class: ClassAuthFailure, want: BreakerClosed},
+				{class: ClassDialTimeout, want: BreakerClosed},
+				{class: ClassAuthFailure, want: BreakerOpen},
+			},
+		},
+		{
+			name:      "success resets the count",
+			threshold: 2,
+			steps: []step{
+				{class: ClassAuthFailure, want: BreakerClosed},
+				{class: ClassOK, want: BreakerClosed},
+				{class: ClassAuthFailure, want: BreakerClosed},
+			},
+		},
+		{
+			name: "threshold 0 never opens",
+			steps: []step{
+				{class: ClassAuthFailure, want: BreakerClosed},
+				{class: ClassAuthFailure, want: BreakerClosed},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			breaker := NewBreaker(test.threshold, time.Hour)
+			at := now
+			for i, step := range test.steps {
+				at = at.Add(step.after)
+				if step.class != "" {
+					breaker.Record("A", step.class, at)
+				}
+				if got := breaker.State("A", at); got != step.want {
+					t.Fatalf("step %d: state %s, want %s", i, got, step.want)
+				}
+			}
+		})
+	}
+}
+
+func TestBreakerSave(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "breaker.json")
+	breaker, err := LoadBreaker(filename, 1, time.Hour)
+	if err != nil {
+		t.Fatalf("missing file: %v", err)
+	}
+	breaker.Record("A", ClassAuthFailure, now)
+	if err := breaker.Save(filename); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadBreaker(filename, 1, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := loaded.State("A", now.Add(time.Minute)); got != BreakerOpen {
+		t.Errorf("loaded state %s, want open", got)
+	}
+	if got := loaded.State("A", now.Add(time.Hour)); got != BreakerHalfOpen {
+		t.Errorf("loaded state after the cool-down %s, want half-open", got)
+	}
+}
+
+func TestBreakerCopy(t *testing.T) {
+	// the file holds A and B from another run, this run collected B and C
+	saved := NewBreaker(1, time.Hour)
+	saved.Record("A", ClassAuthFailure, now)
+	saved.Record("B", ClassAuthFailure, now)
+	run := NewBreaker(1, time.Hour)
+	run.Record("C", ClassAuthFailure, now)
+	saved.Copy(run, []string{"B", "C"})
+	want := map[string]string{"A": BreakerOpen, "B": BreakerClosed, "C": BreakerOpen}
+	for array, state := range want {
+		if got := saved.State(array, now); got != state {
+			t.Errorf("%s is %s, want %s", array, got, state)
+		}
+	}
+}
@@ -0,0 +1,281 @@
+// Package collector runs the vendor commands on the arrays of an inventory
+// and turns their output into a snapshot.
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"dataCollection/aggregate"
+	"dataCollection/model"
+	"dataCollection/transport"
+	"dataCollection/transport/rest"
+	"dataCollection/transport/ssh"
+	"dataCollection/vendors"
+)
+
+// CollectArray runs the commands through runner, or over the connection conns holds for
+// the target when runner is nil, and parses the pools and system. Every command is checked
+// against the read-only allowlist of the model and, unless it is replayed, audited
+func CollectArray(ctx context.Context, conns *ssh.Manager, target ssh.Target, runner transport.Runner, array, site, type_s, client_s, arrayModel string) (output model.Pools, system model.System, stats model.CollectStats, firstErr error) {
+	var err error
+	var poolData model.Pools
+	fail := func(phase, class string, err error) {
+		slog.Error("collection failed", "array", array, "model", arrayModel, "phase", phase, "class", class, "error", err)
+		if firstErr == nil {
+			firstErr = &collectError{Class: class, Err: err}
+		}
+	}
+	if !vendors.Supported[arrayModel] {
+		fail("connect", ClassUnsupportedModel, fmt.Errorf("CollectArray: %s: unsupported model %q", array, arrayModel))
+		return poolData, system, stats, firstErr
+	}
+	guard := transport.Guard{
+		Runner: runner,
+		Allow:  func(command string) error { return vendors.Allowed(arrayModel, command) },
+		Audit:  conns.Audit,
+		Array:  array,
+		Host:   target.Host,
+		User:   conns.User,
+	}
+	switch runner.(type) {
+	case nil:
+		connectStart := time.Now()
+		client, err := conns.Get(ctx, target)
+		stats.ConnectTime = time.Since(connectStart)
+		if err != nil {
+			fail("connect", classifyDialError(err), fmt.Errorf("CollectArray: connect: %s: %w", array, err))
+			return poolData, system, stats, firstErr
+		}
+		defer func() {
+			class := ErrorClass(firstErr)
+			conns.Release(target.Host, client, class == ClassCommandError || class == ClassCommandTimeout)
+		}()
+		guard.Runner = conns.Runner(client)
+	case transport.Replay:
+		// recorded output is not sent anywhere
+		guard.Audit = nil
+	}
+	runner = guard
+
+	commandStart := time.Now()
+	data, err := getData(ctx, runner, array, arrayModel)
+	if err != nil {
+		class := classifyCommandError(err)
+		fail("data", class, err)
+		// a REST api logs in with every request, another one would only count towards a lockout
+		if class == ClassAuthFailure || class == ClassDialError || class == ClassDialTimeout {
+			stats.CommandTime = time.Since(commandStart)
+			return poolData, system, stats, firstErr
+		}
+	}
+
+	fw, err := getFw(ctx, runner, array, arrayModel)
+	if err != nil {
+		fail("firmware", classifyCommandError(err), err)
+	}
+	stats.CommandTime = time.Since(commandStart)
+	stats.OutputBytes = len(data) + len(fw)
+
+	poolData, err = vendors.ParsePools(data, fw, arrayModel, array, site, type_s, client_s)
+	if err != nil {
+		fail("parse", ClassParseError, err)
+	}
+
+	system, err = vendors.ParseSystem(fw, arrayModel, array, site, client_s)
+	if err != nil {
+		fail("system", ClassParseError, err)
+	}
+
+	return poolData, system, stats, firstErr
+}
+
+// Options struct which contains the
+// credentials and limits of a collection
+type Options struct {
+	Username    string
+	Password    string
+	Concurrency int
+	// CommandTimeout and MaxOutput limit every command, 0 uses the ssh defaults
+	CommandTimeout time.Duration
+	MaxOutput      int
+	// Retries is how many more attempts an array gets after a timeout or dropped
+	// connection, waiting RetryBackoff before the first and doubling after that
+	Retries      int
+	RetryBackoff time.Duration
+	// Breaker skips arrays with too many auth failures in a row, nil never skips
+	Breaker *Breaker
+	// Connections are reused across calls when set, otherwise
+	// every array gets a new connection that is closed afterwards
+	Connections *ssh.Manager
+	// Fixtures replays the recorded output below this directory instead of connecting
+	Fixtures string
+}
+
+// Collect collects every array and returns the pools, systems and client rollups
+// of the arrays that succeeded. The error joins the failures of all other arrays,
+// so a snapshot is returned even when some arrays could not be collected.
+func Collect(ctx context.Context, arrays []model.Array, options Options) (model.Snapshot, error) {
+	results := CollectArrays(ctx, arrays, options)
+	return Snapshot(results, time.Now()), ResultsError(results)
+}
+
+// Snapshot builds the snapshot of a run from its results
+func Snapshot(results []model.ArrayResult, now time.Time) model.Snapshot {
+	pools, systems := aggregate.Merge(results)
+	var clients []model.Client
+	for _, name := range aggregate.ClientNames(results) {
+		clients = append(clients, aggregate.ClientRollup(name, pools))
+	}
+	aggregate.ApplyCoverage(clients, results)
+	return model.Snapshot{Time: now, Pools: pools.Pools, Systems: systems, Clients: clients}
+}
+
+// ResultsError joins the errors of all failed arrays, nil when all succeeded
+func ResultsError(results []model.ArrayResult) error {
+	var errs []error
+	for _, result := range results {
+		if result.Err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", result.Array.Name, result.Err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// CollectArrays runs CollectArray for every array, at most concurrency at a time,
+// and returns the results in inventory order
+func CollectArrays(ctx context.Context, arrays []model.Array, options Options) []model.ArrayResult {
+	concurrency := options.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	conns := options.Connections
+	if conns == nil {
+		conns = ssh.NewManager(options.Username, options.Password, false)
+		conns.CommandTimeout = options.CommandTimeout
+		conns.MaxOutput = options.MaxOutput
+		defer conns.Close()
+	}
+	results := make([]model.ArrayResult, len(arrays))
+	limit := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i := range arrays {
+		wg.Add(1)
+		limit <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-limit }()
+			results[i] = collectWithRetries(ctx, conns, arrays[i], options)
+		}(i)
+	}
+	wg.Wait()
+	return results
+}
+
+// collectWithRetries collects one array unless its breaker is open, and tries
+// again after transient errors as long as retries are left
+func collectWithRetries(ctx context.Context, conns *ssh.Manager, array model.Array, options Options) (result model.ArrayResult) {
+	result.Array = array
+	result.Started = time.Now()
+	defer func() {
+		result.Duration = time.Since(result.Started)
+	}()
+	if options.Breaker != nil {
+		result.Breaker = options.Breaker.State(array.Name, result.Started)
+		if result.Breaker == BreakerOpen {
+			slog.Warn("circuit open, skipping", "array", array.Name, "model", array.Model, "phase", "connect")
+			result.Err = &collectError{Class: ClassCircuitOpen, Err: fmt.Errorf("collectWithRetries: %s: skipped after repeated auth failures", array.Name)}
+			return result
+		}
+	}
+	runner, err := ArrayRunner(array, conns, options.Fixtures)
+	if err != nil {
+		result.Err = &collectError{Class: ClassCommandError, Err: err}
+		return result
+	}
+	for {
+		result.Attempts++
+		slog.Info("connecting", "array", array.Name, "model", array.Model, "phase", "connect", "host", array.Ip, "attempt", result.Attempts)
+		result.Pools, result.System, result.Stats, result.Err = CollectArray(ctx, conns, ssh.TargetOf(array), runner, array.Name, array.Site, array.Type, array.Client, array.Model)
+		if result.Attempts > options.Retries || !transient(result.Err) {
+			break
+		}
+		wait := backoff(options.RetryBackoff, result.Attempts)
+		slog.Warn("retrying", "array", array.Name, "model", array.Model, "phase", "retry", "attempt", result.Attempts, "wait", wait, "error", result.Err)
+		if !sleep(ctx, wait) {
+			break
+		}
+	}
+	if options.Breaker != nil {
+		options.Breaker.Record(array.Name, ErrorClass(result.Err), time.Now())
+		result.Breaker = options.Breaker.State(array.Name, time.Now())
+	}
+	return result
+}
+
+func getData(ctx context.Context, runner transport.Runner, array, arrayModel string) ([]byte, error) {
+	return runCommand(ctx, runner, array, vendors.Commands[arrayModel].Data)
+}
+
+func getFw(ctx context.Context, runner transport.Runner, array, arrayModel string) ([]byte, error) {
+	return runCommand(ctx, runner, array, vendors.Commands[arrayModel].Firmware)
+}
+
+// runCommand returns the stdout of a command, stderr of a command
+// that succeeded is only logged since it is never data
+func runCommand(ctx context.Context, runner transport.Runner, array, command string) ([]byte, error) {
+	stdout, stderr, err := runner.Run(ctx, command)
+	if message := strings.TrimSpace(string(stderr)); err == nil && message != "" {
+		slog.Warn("command wrote to stderr", "array", array, "phase", "command", "command", command, "stderr", message)
+	}
+	return stdout, err
+}
+
+// ArrayRunner returns the runner of an array that is not collected over ssh: the output
+// recorded below fixtures when it is set, or the REST api of the array. It is nil for ssh
+func ArrayRunner(array model.Array, conns *ssh.Manager, fixtures string) (transport.Runner, error) {
+	if fixtures != "" {
+		dir, err := FixtureDir(fixtures, array)
+		if err != nil {
+			return nil, err
+		}
+		return transport.Replay{Dir: dir}, nil
+	}
+	if array.Transport != model.TransportREST {
+		return nil, nil
+	}
+	runner, err := rest.NewRunner(array.Ip, conns.User, conns.Password, array.REST, vendors.RESTPaths[array.Model])
+	if err != nil {
+		return nil, fmt.Errorf("ArrayRunner: %s: %w", array.Name, err)
+	}
+	runner.Timeout = conns.CommandTimeout
+	runner.MaxOutput = conns.MaxOutput
+	return runner, nil
+}
+
+// FixtureDir finds the recorded output of an array below root: the fixture
+// of the inventory entry, else the first code level recorded for its model
+func FixtureDir(root string, array model.Array) (string, error) {
+	if array.Fixture != "" {
+		return filepath.Join(root, array.Fixture), nil
+	}
+	matches, err := filepath.Glob(filepath.Join(root, array.Model, "*", "*"))
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(matches)
+	for _, match := range matches {
+		if info, err := os.Stat(match); err == nil && info.IsDir() {
+			return match, nil
+		}
+	}
+	return "", fmt.Errorf("no fixtures for model %s in %s", array.Model, root)
+}
@@ -0,0 +1,165 @@
+package collector
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"dataCollection/model"
+	"dataCollection/transport"
+)
+
+// error classes of a failed array collection
+const (
+	ClassOK               = "ok"
+	ClassAuthFailure      = "auth_failure"
+	ClassDialTimeout      = "dial_timeout"
+	ClassDialError        = "dial_error"
+	ClassCommandError     = "command_error"
+	ClassCommandTimeout   = "command_timeout"
+	ClassCommandDenied    = "command_denied"
+	ClassParseError       = "parse_error"
+	ClassUnsupportedModel = "unsupported_model"
+	ClassCircuitOpen      = "circuit_open"
+)
+
+// collectError attaches the error class to an error of CollectArray
+type collectError struct {
+	Class string
+	Err   error
+}
+
+func (e *collectError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *collectError) Unwrap() error {
+	return e.Err
+}
+
+// classifyDialError tells authentication problems apart from network ones
+func classifyDialError(err error) string {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return ClassDialTimeout
+	}
+	if strings.Contains(err.Error(), "unable to authenticate") {
+		return ClassAuthFailure
+	}
+	return ClassDialError
+}
+
+// classifyCommandError tells hung and refused commands apart from failing ones,
+// and on REST apis, which connect with every command, login and network problems
+func classifyCommandError(err error) string {
+	if errors.Is(err, transport.ErrTimeout) {
+		return ClassCommandTimeout
+	}
+	if errors.Is(err, transport.ErrNotAllowed) {
+		return ClassCommandDenied
+	}
+	if errors.Is(err, transport.ErrUnauthorized) {
+		return ClassAuthFailure
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return classifyDialError(err)
+	}
+	var certErr *tls.CertificateVerificationError
+	if errors.As(err, &certErr) {
+		return ClassDialError
+	}
+	return ClassCommandError
+}
+
+func ErrorClass(err error) string {
+	if err == nil {
+		return ClassOK
+	}
+	var collectErr *collectError
+	if errors.As(err, &collectErr) {
+		return collectErr.Class
+	}
+	return "unknown"
+}
+
+// RunReport struct which contains the outcome
+// of every array of one cycle
+type RunReport struct {
+	Scope    string        `json:"scope"`
+	Started  time.Time     `json:"started"`
+	Duration float64       `json:"duration_seconds"`
+	Status   string        `json:"status"`
+	Arrays   []ArrayReport `json:"arrays"`
+}
+
+type ArrayReport struct {
+	Array    string  `json:"array"`
+	Model    string  `json:"model"`
+	Status   string  `json:"status"`
+	Error    string  `json:"error,omitempty"`
+	Duration float64 `json:"duration_seconds"`
+	Pools    int     `json:"pools"`
+	Attempts int     `json:"attempts"`
+	Breaker  string  `json:"breaker,omitempty"`
+}
+
+func NewRunReport(scope string, started time.Time, results []model.ArrayResult) RunReport {
+	report := RunReport{Scope: scope, Started: started, Duration: time.Since(started).Seconds()}
+	failed := 0
+	for _, res := range results {
+		arrayReport := ArrayReport{
+			Array:    res.Array.Name,
+			Model:    res.Array.Model,
+			Status:   ErrorClass(res.Err),
+			Duration: res.Duration.Seconds(),
+			Pools:    len(res.Pools.Pools),
+			Attempts: res.Attempts,
+			Breaker:  res.Breaker,
+		}
+		if res.Err != nil {
+			arrayReport.Error = res.Err.Error()
+			failed++
+		}
+		report.Arrays = append(report.Arrays, arrayReport)
+	}
+	switch {
+	case failed == 0:
+		report.Status = "success"
+	case failed < len(results):
+		report.Status = "partial"
+	default:
+		report.Status = "failure"
+	}
+	return report
+}
+
+func (report RunReport) Print(out io.Writer) {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ARRAY\tMODEL\tSTATUS\tPOOLS\tSECONDS\tATTEMPTS\tBREAKER\tERROR")
+	for _, array := range report.Arrays {
+		breaker := array.Breaker
+		if breaker == "" {
+			breaker = "-"
+		}
+		fmt.Fprintln(w, array.Array+"\t"+array.Model+"\t"+array.Status+"\t"+strconv.Itoa(array.Pools)+"\t"+fmt.Sprintf("%.1f", array.Duration)+"\t"+strconv.Itoa(array.Attempts)+"\t"+breaker+"\t"+array.Error)
+	}
+	w.Flush()
+	fmt.Fprintln(out, "run "+report.Status+": "+strconv.Itoa(len(report.Arrays))+" arrays in "+fmt.Sprintf("%.1f", report.Duration)+"s")
+}
+
+func (report RunReport) Write(filename string) error {
+	byteValue, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, byteValue, 0644)
+}
@@ -0,0 +1,59 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// maxBackoff caps the wait between two attempts
+const maxBackoff = time.Minute
+
+// transient reports whether a failed collection is worth another attempt:
+// timeouts and dropped connections. Auth failures are never retried since
+// every attempt counts towards locking the service account
+func transient(err error) bool {
+	switch ErrorClass(err) {
+	case ClassDialTimeout:
+		return true
+	case ClassDialError, ClassCommandError:
+		if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNABORTED) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return true
+		}
+		// the ssh handshake does not wrap its errors
+		message := err.Error()
+		return strings.Contains(message, "connection reset") || strings.HasSuffix(message, ": EOF")
+	}
+	return false
+}
+
+// backoff is the wait before attempt, doubling from base with up to a quarter of jitter
+func backoff(base time.Duration, attempt int) time.Duration {
+	wait := base
+	for i := 1; i < attempt && wait < maxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > maxBackoff {
+		wait = maxBackoff
+	}
+	if wait <= 0 {
+		return 0
+	}
+	return wait + time.Duration(rand.Int63n(int64(wait)/4+1))
+}
+
+// sleep waits for d or until ctx ends, false when ctx ended first
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,75 @@
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"syscall"
+	"testing"
+	"time"
+
+	"dataCollection/transport"
+)
+
+func TestTransient(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "dial timeout", err: &collectError{Class: ClassDialTimeout, Err: errors.New("dial tcp: i/o timeout")}, want: true},
+		{name: "connection reset", err: &collectError{Class: ClassCommandError, Err: fmt.Errorf("read: %w", syscall.ECONNRESET)}, want: true},
+		{name: "unexpected eof", err: &collectError{Class: ClassCommandError, Err: fmt.Errorf("lsmdiskgrp: %w", io.ErrUnexpectedEOF)}, want: true},
+		{name: "handshake eof", err: &collectError{Class: ClassDialError, Err: errors.New("ssh: handshake failed: EOF")}, want: true},
+		{name: "dial refused", err: &collectError{Class: ClassDialError, Err: errors.New("dial tcp: connection refused")}},
+		{name: "auth failure", err: &collectError{Class: ClassAuthFailure, Err: errors.New("ssh: unable to authenticate")}},
+		{name: "parse error", err: &collectError{Class: ClassParseError, Err: errors.New("unexpected header")}},
+		{name: "unclassified", err: errors.New("connection reset by peer")},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := transient(test.err); got != test.want {
+				t.Errorf("transient = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestClassifyCommandError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{name: "timeout", err: fmt.Errorf("lsvdisk: %w", transport.ErrTimeout), want: ClassCommandTimeout},
+		{name: "denied", err: fmt.Errorf("%w: rmmdiskgrp", transport.ErrNotAllowed), want: ClassCommandDenied},
+		{name: "unauthorized", err: fmt.Errorf("GET: %w", transport.ErrUnauthorized), want: ClassAuthFailure},
+		{name: "exit status", err: &transport.CommandError{Command: "lsmdiskgrp", ExitStatus: 1}, want: ClassCommandError},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := classifyCommandError(test.err); got != test.want {
+				t.Errorf("class %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		base    time.Duration
+		attempt int
+		min     time.Duration
+	}{
+		{base: time.Second, attempt: 1, min: time.Second},
+		{base: time.Second, attempt: 3, min: 4 * time.Second},
+		{base: time.Second, attempt: 20, min: maxBackoff},
+		{base: 0, attempt: 2},
+	}
+	for _, test := range tests {
+		got := backoff(test.base, test.attempt)
+		if got < test.min || got > test.min+test.min/4 {
+			t.Errorf("backoff(%v, %d) = %v, want %v plus up to a quarter", test.base, test.attempt, got, test.min)
+		}
+	}
+}
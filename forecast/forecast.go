@@ -0,0 +1,349 @@
+// Package forecast estimates from the capacity history when pools and
+// client rollups reach a usage threshold.
+package forecast
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"dataCollection/model"
+	"dataCollection/output"
+)
+
+// Sample struct which contains one historical
+// capacity measurement of a pool
+type Sample struct {
+	Time          time.Time `json:"time"`
+	ArrayName     string    `json:"array"`
+	PoolId        string    `json:"pool_id"`
+	PoolName      string    `json:"pool"`
+	Client        string    `json:"client"`
+	Site          string    `json:"site"`
+	Type          string    `json:"type"`
+	TotalCapacity float64   `json:"total"`
+	UsedCapacity  float64   `json:"used"`
+}
+
+// Forecast struct which contains the linear trend of a pool
+// or of a client/site rollup, days are -1 when usage is not growing
+type Forecast struct {
+	Name               string
+	Client             string
+	Site               string
+	Samples            int
+	TotalCapacity      float64
+	UsedCapacity       float64
+	GrowthPerDay       float64
+	Threshold          float64
+	DaysUntilThreshold float64
+	DaysUntilFull      float64
+}
+
+type HistorySource interface {
+	Samples(since time.Time) ([]Sample, error)
+}
+
+// FileHistory keeps pool samples in a local newline delimited json file
+type FileHistory struct {
+	Filename string
+}
+
+func (h FileHistory) Samples(since time.Time) ([]Sample, error) {
+	var output []Sample
+	file, err := os.Open(h.Filename)
+	if os.IsNotExist(err) {
+		return output, nil
+	}
+	if err != nil {
+		return output, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var sample Sample
+		if err := json.Unmarshal(scanner.Bytes(), &sample); err != nil {
+			continue
+		}
+		if !sample.Time.Before(since) {
+			output = append(output, sample)
+		}
+	}
+	return output, scanner.Err()
+}
+
+// Trim drops the samples older than since, the forecast never reads them again
+func (h FileHistory) Trim(since time.Time) error {
+	samples, err := h.Samples(since)
+	if err != nil {
+		return err
+	}
+	var buffer bytes.Buffer
+	for _, sample := range samples {
+		byteValue, err := json.Marshal(sample)
+		if err != nil {
+			return err
+		}
+		buffer.Write(append(byteValue, '\n'))
+	}
+	temp := h.Filename + ".tmp"
+	if err := ioutil.WriteFile(temp, buffer.Bytes(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(temp, h.Filename)
+}
+
+func (h FileHistory) Append(pools model.Pools, ts time.Time) error {
+	file, err := os.OpenFile(h.Filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	for _, pool := range pools.Pools {
+		// carried forward pools would repeat old values as new samples
+		if pool.Stale {
+			continue
+		}
+		byteValue, err := json.Marshal(SampleFromPool(pool, ts))
+		if err != nil {
+			return err
+		}
+		if _, err := file.Write(append(byteValue, '\n')); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func SampleFromPool(pool model.Pool, ts time.Time) Sample {
+	return Sample{
+		Time:          ts,
+		ArrayName:     pool.ArrayName,
+		PoolId:        pool.Id,
+		PoolName:      pool.PoolName,
+		Client:        pool.Client,
+		Site:          pool.Site,
+		Type:          pool.Type,
+		TotalCapacity: pool.PoolCapacity,
+		UsedCapacity:  pool.PoolCapacityUsed,
+	}
+}
+
+// InfluxHistory reads the testData series back through the influx 1.x query api
+type InfluxHistory struct {
+	URL string
+	DB  string
+}
+
+// InfluxHistoryFromWriteURL turns http://host/write?db=name into the query side of the same database
+func InfluxHistoryFromWriteURL(writeURL string) (InfluxHistory, error) {
+	parsed, err := url.Parse(writeURL)
+	if err != nil {
+		return InfluxHistory{}, err
+	}
+	return InfluxHistory{URL: parsed.Scheme + "://" + parsed.Host, DB: parsed.Query().Get("db")}, nil
+}
+
+func (h InfluxHistory) Samples(since time.Time) ([]Sample, error) {
+	var output []Sample
+	// carried forward pools repeat old values, they are no new samples
+	query := `SELECT "Array","PoolId","Pool","Client","TotalCapacity","UsedCapacity","site","type" FROM "testData" WHERE "Stale" = false AND time >= ` + fmt.Sprint(since.UnixNano())
+	resp, err := http.Get(h.URL + "/query?db=" + url.QueryEscape(h.DB) + "&epoch=s&q=" + url.QueryEscape(query))
+	if err != nil {
+		return output, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return output, fmt.Errorf("InfluxHistory: query returned %s", resp.Status)
+	}
+	var result struct {
+		Results []struct {
+			Series []struct {
+				Columns []string        `json:"columns"`
+				Values  [][]interface{} `json:"values"`
+			} `json:"series"`
+			Error string `json:"error"`
+		} `json:"results"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return output, err
+	}
+	for _, res := range result.Results {
+		if res.Error != "" {
+			return output, fmt.Errorf("InfluxHistory: %s", res.Error)
+		}
+		for _, series := range res.Series {
+			for _, values := range series.Values {
+				row := make(map[string]interface{})
+				for i, column := range series.Columns {
+					if i < len(values) {
+						row[column] = values[i]
+					}
+				}
+				var sample Sample
+				if t, ok := row["time"].(float64); ok {
+					sample.Time = time.Unix(int64(t), 0)
+				}
+				sample.ArrayName, _ = row["Array"].(string)
+				sample.PoolName, _ = row["Pool"].(string)
+				sample.PoolId, _ = row["PoolId"].(string)
+				if sample.PoolId == "" {
+					// written before testData had the pool id
+					sample.PoolId = sample.PoolName
+				}
+				sample.Client, _ = row["Client"].(string)
+				sample.Site, _ = row["site"].(string)
+				sample.Type, _ = row["type"].(string)
+				sample.TotalCapacity, _ = row["TotalCapacity"].(float64)
+				sample.UsedCapacity, _ = row["UsedCapacity"].(float64)
+				output = append(output, sample)
+			}
+		}
+	}
+	return output, nil
+}
+
+// linearTrend fits used capacity against time in days with least squares
+// and returns the growth per day
+func linearTrend(samples []Sample) float64 {
+	if len(samples) < 2 {
+		return 0
+	}
+	start := samples[0].Time
+	var sumX, sumY, sumXY, sumXX float64
+	for _, sample := range samples {
+		x := sample.Time.Sub(start).Hours() / 24
+		sumX += x
+		sumY += sample.UsedCapacity
+		sumXY += x * sample.UsedCapacity
+		sumXX += x * x
+	}
+	n := float64(len(samples))
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		return 0
+	}
+	return (n*sumXY - sumX*sumY) / denominator
+}
+
+func daysUntil(limit, used, growthPerDay float64) float64 {
+	if growthPerDay <= 0 {
+		return -1
+	}
+	if used >= limit {
+		return 0
+	}
+	return (limit - used) / growthPerDay
+}
+
+// Compute fits a trend for every pool and adds up the trends per client and site. Only
+// pools that were in the latest run of their array go into the client and site trends,
+// a pool that was deleted or renamed since would count on for the whole history
+func Compute(samples []Sample, threshold float64) (pools []Forecast, rollups []Forecast) {
+	series := make(map[string][]Sample)
+	latest := make(map[string]time.Time)
+	for _, sample := range samples {
+		key := sample.ArrayName + "/" + sample.PoolId
+		series[key] = append(series[key], sample)
+		if sample.Time.After(latest[sample.ArrayName]) {
+			latest[sample.ArrayName] = sample.Time
+		}
+	}
+	keys := make([]string, 0, len(series))
+	for key := range series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	rollupIndex := make(map[string]int)
+	for _, key := range keys {
+		poolSamples := series[key]
+		sort.Slice(poolSamples, func(i, j int) bool { return poolSamples[i].Time.Before(poolSamples[j].Time) })
+		last := poolSamples[len(poolSamples)-1]
+		forecast := Forecast{
+			Name:          key,
+			Client:        last.Client,
+			Site:          last.Site,
+			Samples:       len(poolSamples),
+			TotalCapacity: last.TotalCapacity,
+			UsedCapacity:  last.UsedCapacity,
+			GrowthPerDay:  linearTrend(poolSamples),
+			Threshold:     threshold,
+		}
+		pools = append(pools, forecast)
+		if last.Time.Before(latest[last.ArrayName]) {
+			continue
+		}
+
+		for _, rollupKey := range []string{last.Client, last.Client + "/" + last.Site} {
+			index, ok := rollupIndex[rollupKey]
+			if !ok {
+				index = len(rollups)
+				rollupIndex[rollupKey] = index
+				rollups = append(rollups, Forecast{Name: rollupKey, Client: last.Client, Threshold: threshold})
+				if strings.Contains(rollupKey, "/") {
+					rollups[index].Site = last.Site
+				}
+			}
+			rollups[index].Samples += forecast.Samples
+			rollups[index].TotalCapacity += forecast.TotalCapacity
+			rollups[index].UsedCapacity += forecast.UsedCapacity
+			rollups[index].GrowthPerDay += forecast.GrowthPerDay
+		}
+	}
+
+	for i := range pools {
+		finishForecast(&pools[i])
+	}
+	for i := range rollups {
+		finishForecast(&rollups[i])
+	}
+	return pools, rollups
+}
+
+func finishForecast(forecast *Forecast) {
+	forecast.DaysUntilThreshold = daysUntil(forecast.TotalCapacity*forecast.Threshold, forecast.UsedCapacity, forecast.GrowthPerDay)
+	forecast.DaysUntilFull = daysUntil(forecast.TotalCapacity, forecast.UsedCapacity, forecast.GrowthPerDay)
+}
+
+func formatDays(days float64) string {
+	if days < 0 || math.IsInf(days, 0) {
+		return "never"
+	}
+	return fmt.Sprintf("%.0f", days)
+}
+
+func Print(pools, rollups []Forecast) {
+	fmt.Println("Forecast (threshold / full in days):")
+	for _, forecast := range append(rollups, pools...) {
+		fmt.Println(" " + forecast.Name + ": growth " + fmt.Sprintf("%.0f", forecast.GrowthPerDay/1024/1024/1024) + " GiB/day, " + formatDays(forecast.DaysUntilThreshold) + " / " + formatDays(forecast.DaysUntilFull))
+	}
+}
+
+func Write(writeUrl string, pools, rollups []Forecast, ts string) error {
+	var lines []string
+	for _, forecast := range pools {
+		lines = append(lines, "forecastData"+output.Tags("scope", "pool", "name", forecast.Name, "client", forecast.Client, "site", forecast.Site)+forecastFields(forecast)+" "+ts)
+	}
+	for _, forecast := range rollups {
+		scope := "client"
+		if forecast.Site != "" {
+			scope = "site"
+		}
+		lines = append(lines, "forecastData"+output.Tags("scope", scope, "name", forecast.Name, "client", forecast.Client, "site", forecast.Site)+forecastFields(forecast)+" "+ts)
+	}
+	return output.PostInflux(writeUrl, lines)
+}
+
+func forecastFields(forecast Forecast) string {
+	return " Samples=" + fmt.Sprint(forecast.Samples) + ",GrowthPerDay=" + fmt.Sprintf("%f", forecast.GrowthPerDay) + ",DaysUntilThreshold=" + fmt.Sprintf("%f", forecast.DaysUntilThreshold) + ",DaysUntilFull=" + fmt.Sprintf("%f", forecast.DaysUntilFull)
+}
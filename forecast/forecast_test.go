@@ -0,0 +1,149 @@
+package forecast
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"dataCollection/model"
+)
+
+const tib = 1024 * 1024 * 1024 * 1024
+
+var start = time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+// daily returns one sample a day of a pool, used growing by growth per day
+func daily(array, id string, days int, used, growth float64) []Sample {
+	var samples []Sample
+	for day := 0; day < days; day++ {
+		samples = append(samples, Sample{Time: start.AddDate(0, 0, day), ArrayName: array, PoolId: id, PoolName: id, Client: "P16", Site: "DC1", TotalCapacity: 100 * tib, UsedCapacity: used + float64(day)*growth})
+	}
+	return samples
+}
+
+func TestLinearTrend(t *testing.T) {
+	tests := []struct {
+		name    string
+		samples []Sample
+		want    float64
+	}{
+		{name: "no samples", want: 0},
+		{name: "one sample", samples: daily("A", "0", 1, 10*tib, tib), want: 0},
+		{name: "steady growth", samples: daily("A", "0", 10, 10*tib, tib), want: tib},
+		{name: "flat", samples: daily("A", "0", 10, 10*tib, 0), want: 0},
+		{name: "shrinking", samples: daily("A", "0", 10, 50*tib, -2*tib), want: -2 * tib},
+		{name: "same time", samples: []Sample{{Time: start, UsedCapacity: 1}, {Time: start, UsedCapacity: 2}}, want: 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := linearTrend(test.samples); math.Abs(got-test.want) > 1 {
+				t.Errorf("linearTrend = %f, want %f", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDaysUntil(t *testing.T) {
+	tests := []struct {
+		limit, used, growth, want float64
+	}{
+		{limit: 90, used: 50, growth: 2, want: 20},
+		{limit: 90, used: 95, growth: 2, want: 0},
+		{limit: 90, used: 50, growth: 0, want: -1},
+		{limit: 90, used: 50, growth: -1, want: -1},
+	}
+	for _, test := range tests {
+		if got := daysUntil(test.limit, test.used, test.growth); got != test.want {
+			t.Errorf("daysUntil(%v, %v, %v) = %v, want %v", test.limit, test.used, test.growth, got, test.want)
+		}
+	}
+}
+
+func TestCompute(t *testing.T) {
+	var samples []Sample
+	samples = append(samples, daily("A", "0", 10, 10*tib, tib)...)
+	samples = append(samples, daily("A", "1", 10, 20*tib, 2*tib)...)
+	// pool 2 of A was deleted after five days, B was last collected two days before A
+	samples = append(samples, daily("A", "2", 5, 30*tib, tib)...)
+	samples = append(samples, daily("B", "0", 8, 40*tib, tib)...)
+
+	pools, rollups := Compute(samples, 0.9)
+	if len(pools) != 4 {
+		t.Fatalf("%d pool forecasts, want 4", len(pools))
+	}
+	if pools[0].Name != "A/0" || pools[0].Samples != 10 || pools[0].UsedCapacity != 19*tib {
+		t.Errorf("first pool forecast %+v", pools[0])
+	}
+	if want := float64(90*tib-19*tib) / tib; math.Abs(pools[0].DaysUntilThreshold-want) > 0.01 {
+		t.Errorf("days until threshold %f, want %f", pools[0].DaysUntilThreshold, want)
+	}
+	if len(rollups) != 2 {
+		t.Fatalf("%d rollups, want client and client/site", len(rollups))
+	}
+	for _, rollup := range rollups {
+		// A/0, A/1 and B/0 are in the latest run of their array, A/2 is not
+		if rollup.TotalCapacity != 300*tib || rollup.UsedCapacity != 19*tib+38*tib+47*tib {
+			t.Errorf("rollup %s has %v total and %v used", rollup.Name, rollup.TotalCapacity/tib, rollup.UsedCapacity/tib)
+		}
+		if rollup.Samples != 28 {
+			t.Errorf("rollup %s has %d samples, want 28", rollup.Name, rollup.Samples)
+		}
+	}
+	if rollups[1].Name != "P16/DC1" || rollups[1].Site != "DC1" {
+		t.Errorf("site rollup %+v", rollups[1])
+	}
+}
+
+func TestFileHistoryTrim(t *testing.T) {
+	history := FileHistory{Filename: filepath.Join(t.TempDir(), "history.ndjson")}
+	for day := 0; day < 5; day++ {
+		pools := model.Pools{Pools: []model.Pool{{ArrayName: "A", Id: "0"}, {ArrayName: "B", Id: "0", Stale: true}}}
+		if err := history.Append(pools, start.AddDate(0, 0, day)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := history.Trim(start.AddDate(0, 0, 3)); err != nil {
+		t.Fatal(err)
+	}
+	samples, err := history.Samples(time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) != 2 || !samples[0].Time.Equal(start.AddDate(0, 0, 3)) {
+		t.Errorf("%d samples kept from %v, want the last two days of A", len(samples), samples)
+	}
+}
+
+func TestInfluxHistory(t *testing.T) {
+	var query string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query().Get("q")
+		json.NewEncoder(w).Encode(map[string]interface{}{"results": []interface{}{map[string]interface{}{"series": []interface{}{map[string]interface{}{
+			"columns": []string{"time", "Array", "PoolId", "Pool", "Client", "TotalCapacity", "UsedCapacity", "site", "type"},
+			"values": [][]interface{}{
+				{1760000000, "A", "7", "P16_SSD01", "P16", 100, 50, "DC1", "internal"},
+				{1760000000, "A", nil, "P16_HDD01", "P16", 100, 50, "DC1", "internal"},
+			},
+		}}}}})
+	}))
+	defer server.Close()
+	history, err := InfluxHistoryFromWriteURL(server.URL + "/write?db=godata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	samples, err := history.Samples(start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(query, `"Stale" = false`) {
+		t.Errorf("query %s reads carried forward pools", query)
+	}
+	if len(samples) != 2 || samples[0].PoolId != "7" || samples[1].PoolId != "P16_HDD01" {
+		t.Errorf("samples %+v, want the pool id and the name for rows without one", samples)
+	}
+}
@@ -1,7 +1,10 @@
 module dataCollection
 
-go 1.17
+go 1.21
 
-require golang.org/x/crypto v0.0.0-20210921155107-089bfa567519
+require (
+	go.etcd.io/bbolt v1.3.6
+	golang.org/x/crypto v0.0.0-20210921155107-089bfa567519
+)
 
 require golang.org/x/sys v0.0.0-20210615035016-665e8c7367d1 // indirect
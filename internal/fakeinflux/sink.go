@@ -0,0 +1,86 @@
+// Package fakeinflux is an http server that accepts influx line protocol
+// writes and keeps the lines, standing in for the database.
+package fakeinflux
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+)
+
+// Sink records every line written to /write
+type Sink struct {
+	server *httptest.Server
+	mu     sync.Mutex
+	lines  []string
+	writes int
+	// Status is returned for every write, 204 like influx when zero
+	Status int
+}
+
+func New() *Sink {
+	s := &Sink{}
+	s.server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// URL is the write url of the database name given
+func (s *Sink) URL(db string) string {
+	return s.server.URL + "/write?db=" + db
+}
+
+// Lines returns the lines written so far
+func (s *Sink) Lines() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.lines...)
+}
+
+// Measurement returns the lines of one measurement
+func (s *Sink) Measurement(name string) []string {
+	var lines []string
+	for _, line := range s.Lines() {
+		if strings.HasPrefix(line, name+",") || strings.HasPrefix(line, name+" ") {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// Writes returns how many write requests were made
+func (s *Sink) Writes() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.writes
+}
+
+func (s *Sink) Close() {
+	s.server.Close()
+}
+
+func (s *Sink) handle(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/write" || r.Method != http.MethodPost {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	s.writes++
+	for _, line := range strings.Split(string(body), "\n") {
+		if strings.TrimSpace(line) != "" {
+			s.lines = append(s.lines, line)
+		}
+	}
+	status := s.Status
+	s.mu.Unlock()
+	if status == 0 {
+		status = http.StatusNoContent
+	}
+	w.WriteHeader(status)
+}
@@ -0,0 +1,111 @@
+// Package fakeontap is an https server answering the ONTAP REST api paths
+// with recorded json, standing in for a cluster.
+package fakeontap
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Response is the scripted answer to one api path
+type Response struct {
+	Body string
+	// Status is 200 when zero
+	Status int
+	// Delay is waited before answering, for slow clusters
+	Delay time.Duration
+}
+
+// Server answers GET requests with the response registered for the path,
+// other methods get 405 and unknown paths 404 like ONTAP would
+type Server struct {
+	User     string
+	Password string
+
+	server    *httptest.Server
+	mu        sync.Mutex
+	responses map[string]Response
+	requests  []string
+}
+
+// New starts a server with a self-signed certificate on a random port of 127.0.0.1
+func New(user, password string) *Server {
+	s := &Server{User: user, Password: password, responses: make(map[string]Response)}
+	s.server = httptest.NewTLSServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// Addr is the host:port the server listens on
+func (s *Server) Addr() string {
+	return strings.TrimPrefix(s.server.URL, "https://")
+}
+
+// CertificatePEM is the certificate of the server, to be trusted as a ca_file
+func (s *Server) CertificatePEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.server.Certificate().Raw})
+}
+
+// Handle sets the response of a path, without its query for every query or
+// with it for that query only, as the later pages of a listing are asked for
+func (s *Server) Handle(path string, response Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responses[path] = response
+}
+
+// Requests returns the method and url of every request received so far, in order
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+// Close stops the server
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests = append(s.requests, r.Method+" "+r.URL.RequestURI())
+	response, ok := s.responses[r.URL.RequestURI()]
+	if !ok {
+		response, ok = s.responses[r.URL.Path]
+	}
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/hal+json")
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "The method is not allowed")
+		return
+	}
+	if user, password, _ := r.BasicAuth(); user != s.User || password != s.Password {
+		writeError(w, http.StatusUnauthorized, "User is not authorized")
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, "API not found")
+		return
+	}
+	if response.Delay > 0 {
+		select {
+		case <-time.After(response.Delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if response.Status != 0 {
+		w.WriteHeader(response.Status)
+	}
+	w.Write([]byte(response.Body))
+}
+
+// writeError answers like ONTAP does, {"error": {"message": ...}}
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.WriteHeader(status)
+	w.Write([]byte(`{"error": {"message": "` + message + `", "code": "` + http.StatusText(status) + `"}}`))
+}
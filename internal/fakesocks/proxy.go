@@ -0,0 +1,168 @@
+// Package fakesocks is an in-process socks5 proxy supporting CONNECT with
+// or without a user name and password, so routes through a proxy can be
+// run end to end.
+package fakesocks
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+)
+
+// Proxy relays CONNECT requests to their target and counts them
+type Proxy struct {
+	User     string
+	Password string
+
+	listener net.Listener
+	mu       sync.Mutex
+	connects int
+	wg       sync.WaitGroup
+}
+
+// New starts a proxy on a random port of 127.0.0.1, an empty
+// user lets clients in without authentication
+func New(user, password string) (*Proxy, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	p := &Proxy{User: user, Password: password, listener: listener}
+	p.wg.Add(1)
+	go p.serve()
+	return p, nil
+}
+
+// Addr is the host:port the proxy listens on
+func (p *Proxy) Addr() string {
+	return p.listener.Addr().String()
+}
+
+// Connects returns how many CONNECT requests were relayed
+func (p *Proxy) Connects() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.connects
+}
+
+// Close stops accepting connections and waits for the accept loop
+func (p *Proxy) Close() error {
+	err := p.listener.Close()
+	p.wg.Wait()
+	return err
+}
+
+func (p *Proxy) serve() {
+	defer p.wg.Done()
+	for {
+		conn, err := p.listener.Accept()
+		if err != nil {
+			return
+		}
+		go p.handle(conn)
+	}
+}
+
+func (p *Proxy) handle(conn net.Conn) {
+	defer conn.Close()
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil || header[0] != 5 {
+		return
+	}
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return
+	}
+	want := byte(0)
+	if p.User != "" {
+		want = 2
+	}
+	offered := false
+	for _, method := range methods {
+		offered = offered || method == want
+	}
+	if !offered {
+		conn.Write([]byte{5, 0xff})
+		return
+	}
+	conn.Write([]byte{5, want})
+	if want == 2 && !p.authenticate(conn) {
+		return
+	}
+
+	request := make([]byte, 4)
+	if _, err := io.ReadFull(conn, request); err != nil || request[1] != 1 {
+		return
+	}
+	var host string
+	switch request[3] {
+	case 1, 4:
+		ip := make([]byte, 4)
+		if request[3] == 4 {
+			ip = make([]byte, 16)
+		}
+		if _, err := io.ReadFull(conn, ip); err != nil {
+			return
+		}
+		host = net.IP(ip).String()
+	case 3:
+		length := make([]byte, 1)
+		if _, err := io.ReadFull(conn, length); err != nil {
+			return
+		}
+		name := make([]byte, length[0])
+		if _, err := io.ReadFull(conn, name); err != nil {
+			return
+		}
+		host = string(name)
+	default:
+		return
+	}
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(conn, port); err != nil {
+		return
+	}
+	target, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))))
+	if err != nil {
+		conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer target.Close()
+	p.mu.Lock()
+	p.connects++
+	p.mu.Unlock()
+	conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+	go func() {
+		io.Copy(target, conn)
+		target.Close()
+	}()
+	io.Copy(conn, target)
+}
+
+// authenticate checks the username/password sub-negotiation of rfc 1929
+func (p *Proxy) authenticate(conn net.Conn) bool {
+	version := make([]byte, 2)
+	if _, err := io.ReadFull(conn, version); err != nil {
+		return false
+	}
+	user := make([]byte, version[1])
+	if _, err := io.ReadFull(conn, user); err != nil {
+		return false
+	}
+	length := make([]byte, 1)
+	if _, err := io.ReadFull(conn, length); err != nil {
+		return false
+	}
+	password := make([]byte, length[0])
+	if _, err := io.ReadFull(conn, password); err != nil {
+		return false
+	}
+	if string(user) != p.User || string(password) != p.Password {
+		conn.Write([]byte{1, 1})
+		return false
+	}
+	conn.Write([]byte{1, 0})
+	return true
+}
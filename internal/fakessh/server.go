@@ -0,0 +1,355 @@
+// Package fakessh is an in-process ssh server that answers commands with
+// scripted output, so the collector can be run end to end without an array.
+package fakessh
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// AuthMode is the only way the server lets users log in
+type AuthMode int
+
+const (
+	AuthPassword AuthMode = iota
+	AuthKeyboardInteractive
+	AuthKey
+)
+
+func (m AuthMode) String() string {
+	switch m {
+	case AuthPassword:
+		return "password"
+	case AuthKeyboardInteractive:
+		return "keyboard-interactive"
+	case AuthKey:
+		return "key"
+	}
+	return "unknown"
+}
+
+// Response is the scripted answer to one command
+type Response struct {
+	Stdout     string
+	Stderr     string
+	ExitStatus uint32
+	// Delay is waited before anything is written, for slow commands
+	Delay time.Duration
+}
+
+// Server answers exec requests with the response registered for the command,
+// unknown commands get exit status 127 like a shell would
+type Server struct {
+	User          string
+	Password      string
+	Auth          AuthMode
+	AuthorizedKey ssh.PublicKey
+
+	listener   net.Listener
+	mu         sync.Mutex
+	responses  map[string]Response
+	commands   []string
+	handshakes int
+	conns      int
+	sessions   int
+	forwards   int
+	versions   []string
+	drop       int
+	dropped    int
+	wg         sync.WaitGroup
+}
+
+// Option changes the ssh configuration of a server
+type Option func(config *ssh.ServerConfig)
+
+// Algorithms limits the server to the given key exchanges, ciphers and
+// macs, like an old controller offering only legacy ones
+func Algorithms(kex, ciphers, macs []string) Option {
+	return func(config *ssh.ServerConfig) {
+		config.KeyExchanges = kex
+		config.Ciphers = ciphers
+		config.MACs = macs
+	}
+}
+
+// New starts a server on a random port of 127.0.0.1
+func New(user, password string, auth AuthMode, options ...Option) (*Server, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{User: user, Password: password, Auth: auth, listener: listener, responses: make(map[string]Response)}
+	config, err := s.config()
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+	for _, option := range options {
+		option(config)
+	}
+	s.wg.Add(1)
+	go s.serve(config)
+	return s, nil
+}
+
+// Addr is the host:port the server listens on
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Handle sets the response of a command
+func (s *Server) Handle(command string, response Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responses[command] = response
+}
+
+// Drop closes the next n connections right after accepting them,
+// like a firewall resetting a flaky link
+func (s *Server) Drop(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.drop = n
+}
+
+// Dropped returns how many connections were closed by Drop
+func (s *Server) Dropped() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dropped
+}
+
+// Commands returns every command received so far, in order
+func (s *Server) Commands() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.commands...)
+}
+
+// Handshakes returns how many clients connected, logged in or not
+func (s *Server) Handshakes() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.handshakes
+}
+
+// Connections returns how many clients logged in
+func (s *Server) Connections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conns
+}
+
+// Sessions returns how many sessions were opened
+func (s *Server) Sessions() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sessions
+}
+
+// ClientVersions returns the version string of every client that logged in
+func (s *Server) ClientVersions() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.versions...)
+}
+
+// Forwards returns how many direct-tcpip channels were opened,
+// a client using the server as jump host opens one per hop
+func (s *Server) Forwards() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.forwards
+}
+
+// Close stops accepting connections and waits for the accept loop
+func (s *Server) Close() error {
+	err := s.listener.Close()
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) config() (*ssh.ServerConfig, error) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.NewSignerFromKey(private)
+	if err != nil {
+		return nil, err
+	}
+	config := &ssh.ServerConfig{}
+	config.AddHostKey(signer)
+	switch s.Auth {
+	case AuthPassword:
+		config.PasswordCallback = func(meta ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if meta.User() == s.User && string(password) == s.Password {
+				return nil, nil
+			}
+			return nil, errors.New("wrong password")
+		}
+	case AuthKeyboardInteractive:
+		config.KeyboardInteractiveCallback = func(meta ssh.ConnMetadata, challenge ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
+			answers, err := challenge("", "", []string{"Password: "}, []bool{false})
+			if err != nil {
+				return nil, err
+			}
+			if meta.User() == s.User && len(answers) == 1 && answers[0] == s.Password {
+				return nil, nil
+			}
+			return nil, errors.New("wrong password")
+		}
+	case AuthKey:
+		config.PublicKeyCallback = func(meta ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if meta.User() == s.User && s.AuthorizedKey != nil && string(key.Marshal()) == string(s.AuthorizedKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, errors.New("key not authorized")
+		}
+	default:
+		return nil, fmt.Errorf("unknown auth mode %d", s.Auth)
+	}
+	return config, nil
+}
+
+func (s *Server) serve(config *ssh.ServerConfig) {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handleConn(conn, config)
+	}
+}
+
+func (s *Server) handleConn(conn net.Conn, config *ssh.ServerConfig) {
+	s.mu.Lock()
+	if s.drop > 0 {
+		s.drop--
+		s.dropped++
+		s.mu.Unlock()
+		conn.Close()
+		return
+	}
+	s.handshakes++
+	s.mu.Unlock()
+	serverConn, channels, requests, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	defer serverConn.Close()
+	s.mu.Lock()
+	s.conns++
+	s.versions = append(s.versions, string(serverConn.ClientVersion()))
+	s.mu.Unlock()
+	go ssh.DiscardRequests(requests)
+	for newChannel := range channels {
+		if newChannel.ChannelType() == "direct-tcpip" {
+			go s.handleForward(newChannel)
+			continue
+		}
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "only sessions are supported")
+			continue
+		}
+		channel, channelRequests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		s.mu.Lock()
+		s.sessions++
+		s.mu.Unlock()
+		go s.handleSession(channel, channelRequests)
+	}
+}
+
+func (s *Server) handleSession(channel ssh.Channel, requests <-chan *ssh.Request) {
+	defer channel.Close()
+	for request := range requests {
+		if request.Type != "exec" {
+			if request.WantReply {
+				request.Reply(false, nil)
+			}
+			continue
+		}
+		command, ok := parseString(request.Payload)
+		if request.WantReply {
+			request.Reply(ok, nil)
+		}
+		if !ok {
+			return
+		}
+		s.mu.Lock()
+		s.commands = append(s.commands, command)
+		response, found := s.responses[command]
+		s.mu.Unlock()
+		if !found {
+			response = Response{Stderr: command + ": command not found\n", ExitStatus: 127}
+		}
+		time.Sleep(response.Delay)
+		io.WriteString(channel, response.Stdout)
+		io.WriteString(channel.Stderr(), response.Stderr)
+		status := make([]byte, 4)
+		binary.BigEndian.PutUint32(status, response.ExitStatus)
+		channel.SendRequest("exit-status", false, status)
+		return
+	}
+}
+
+// handleForward connects a direct-tcpip channel to its target like
+// an ssh server acting as jump host does
+func (s *Server) handleForward(newChannel ssh.NewChannel) {
+	var target struct {
+		Host       string
+		Port       uint32
+		OriginHost string
+		OriginPort uint32
+	}
+	if err := ssh.Unmarshal(newChannel.ExtraData(), &target); err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, "invalid direct-tcpip request")
+		return
+	}
+	conn, err := net.Dial("tcp", net.JoinHostPort(target.Host, fmt.Sprint(target.Port)))
+	if err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		conn.Close()
+		return
+	}
+	s.mu.Lock()
+	s.forwards++
+	s.mu.Unlock()
+	go ssh.DiscardRequests(requests)
+	go func() {
+		io.Copy(conn, channel)
+		conn.Close()
+	}()
+	io.Copy(channel, conn)
+	channel.Close()
+}
+
+// parseString reads the ssh string an exec request carries
+func parseString(payload []byte) (string, bool) {
+	if len(payload) < 4 {
+		return "", false
+	}
+	length := binary.BigEndian.Uint32(payload)
+	if uint32(len(payload)-4) < length {
+		return "", false
+	}
+	return string(payload[4 : 4+length]), true
+}
@@ -0,0 +1,174 @@
+// Package inventory loads and checks the json files listing the arrays.
+package inventory
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"dataCollection/model"
+	"dataCollection/transport/ssh"
+	"dataCollection/vendors"
+)
+
+// Load reads every model=file entry of spec, arrays without a model in the
+// file get the model of the entry and arrays without a route the route of
+// their site or of the file
+func Load(spec string) ([]model.Array, error) {
+	var arrays []model.Array
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		var entryModel string
+		filename := entry
+		if index := strings.Index(entry, "="); index >= 0 {
+			entryModel = strings.ToLower(entry[:index])
+			filename = entry[index+1:]
+		}
+		byteValue, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return arrays, err
+		}
+		var fileArrays model.Arrays
+		if err := json.Unmarshal(byteValue, &fileArrays); err != nil {
+			return arrays, fmt.Errorf("%s: %s", filename, err.Error())
+		}
+		for _, array := range fileArrays.Arrays {
+			if array.Model == "" {
+				array.Model = entryModel
+			}
+			array.Model = strings.ToLower(array.Model)
+			if array.Route == nil {
+				if route, ok := fileArrays.Sites[array.Site]; ok {
+					array.Route = &route
+				} else {
+					array.Route = fileArrays.Route
+				}
+			}
+			arrays = append(arrays, array)
+		}
+	}
+	return arrays, nil
+}
+
+// Validate returns a description of every problem found in the arrays
+func Validate(arrays []model.Array) (problems []string) {
+	names := make(map[string]bool)
+	for i, array := range arrays {
+		prefix := "array " + strconv.Itoa(i) + " (" + array.Name + "): "
+		if array.Name == "" {
+			problems = append(problems, prefix+"missing name")
+		} else if names[array.Name] {
+			problems = append(problems, prefix+"duplicate name")
+		}
+		names[array.Name] = true
+		if array.Ip == "" {
+			problems = append(problems, prefix+"missing ip")
+		}
+		if array.Site == "" {
+			problems = append(problems, prefix+"missing site")
+		}
+		if array.Type == "" {
+			problems = append(problems, prefix+"missing type_arr")
+		}
+		if array.Client == "" {
+			problems = append(problems, prefix+"missing client")
+		}
+		if !vendors.Supported[array.Model] {
+			problems = append(problems, prefix+"unsupported model \""+array.Model+"\"")
+		}
+		if array.Route != nil {
+			for _, problem := range ValidateRoute(*array.Route) {
+				problems = append(problems, prefix+problem)
+			}
+		}
+		if array.SSH != nil {
+			for _, problem := range ssh.CheckOptions(array.Ip, *array.SSH) {
+				problems = append(problems, prefix+problem)
+			}
+		}
+		switch array.Transport {
+		case "", model.TransportSSH:
+		case model.TransportREST:
+			if vendors.RESTPaths[array.Model] == nil {
+				problems = append(problems, prefix+"model \""+array.Model+"\" has no REST api")
+			}
+			if array.REST != nil && array.REST.CAFile != "" {
+				if _, err := os.Stat(array.REST.CAFile); err != nil {
+					problems = append(problems, prefix+"rest ca_file: "+err.Error())
+				}
+			}
+		default:
+			problems = append(problems, prefix+"unknown transport \""+array.Transport+"\"")
+		}
+	}
+	return problems
+}
+
+// FilterClient keeps the arrays of client, all arrays when client is empty
+func FilterClient(arrays []model.Array, client string) []model.Array {
+	if client == "" {
+		return arrays
+	}
+	var output []model.Array
+	for _, array := range arrays {
+		if array.Client == client {
+			output = append(output, array)
+		}
+	}
+	return output
+}
+
+// LoadRoute reads a route file, used for every array that has
+// no route of its own, its site or its inventory file
+func LoadRoute(filename string) (*model.Route, error) {
+	byteValue, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var route model.Route
+	if err := json.Unmarshal(byteValue, &route); err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err.Error())
+	}
+	return &route, nil
+}
+
+// DefaultRoute gives route to every array without one
+func DefaultRoute(arrays []model.Array, route *model.Route) {
+	for i := range arrays {
+		if arrays[i].Route == nil {
+			arrays[i].Route = route
+		}
+	}
+}
+
+// ValidateRoute returns a description of every problem found in a route
+func ValidateRoute(route model.Route) (problems []string) {
+	if route.SOCKS5 != "" && !strings.Contains(route.SOCKS5, "://") {
+		if _, _, err := net.SplitHostPort(route.SOCKS5); err != nil {
+			problems = append(problems, "socks5 \""+route.SOCKS5+"\" is not host:port")
+		}
+	}
+	for i, hop := range route.Jump {
+		if hop.Host == "" {
+			problems = append(problems, "jump host "+strconv.Itoa(i)+" missing host")
+		}
+		if hop.PasswordEnv != "" {
+			if _, ok := os.LookupEnv(hop.PasswordEnv); !ok {
+				problems = append(problems, "jump host "+hop.Host+" password_env "+hop.PasswordEnv+" is not set")
+			}
+		}
+		if hop.KeyFile != "" {
+			if _, err := os.Stat(hop.KeyFile); err != nil {
+				problems = append(problems, "jump host "+hop.Host+" key_file: "+err.Error())
+			}
+		}
+	}
+	return problems
+}
@@ -0,0 +1,49 @@
+package model
+
+import (
+	"strings"
+	"time"
+)
+
+// kinds of inventory changes between two runs
+const (
+	EventPoolAdded      = "pool_added"
+	EventPoolRemoved    = "pool_removed"
+	EventPoolExpanded   = "pool_expanded"
+	EventPoolShrunk     = "pool_shrunk"
+	EventPoolRenamed    = "pool_renamed"
+	EventFirmwareChange = "firmware_changed"
+)
+
+// ChangeEvent struct which contains one inventory
+// change of an array since the previous run
+type ChangeEvent struct {
+	Time     time.Time
+	Kind     string
+	Array    string
+	Site     string
+	Client   string
+	PoolId   string
+	PoolName string
+	From     string
+	To       string
+	Delta    float64
+}
+
+func (e ChangeEvent) Title() string {
+	return strings.ReplaceAll(e.Kind, "_", " ")
+}
+
+func (e ChangeEvent) Text() string {
+	switch e.Kind {
+	case EventPoolAdded:
+		return e.Array + " pool " + e.PoolName + " added with " + e.To
+	case EventPoolRemoved:
+		return e.Array + " pool " + e.PoolName + " removed, it had " + e.From
+	case EventPoolRenamed:
+		return e.Array + " pool " + e.PoolId + " renamed from " + e.From + " to " + e.To
+	case EventFirmwareChange:
+		return e.Array + " firmware changed from " + e.From + " to " + e.To
+	}
+	return e.Array + " pool " + e.PoolName + " " + strings.TrimPrefix(e.Kind, "pool_") + " from " + e.From + " to " + e.To
+}
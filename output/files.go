@@ -0,0 +1,160 @@
+package output
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"dataCollection/model"
+)
+
+// WriteFiles writes the snapshot in every requested file format to dir with
+// a timestamped name and points a "latest" symlink at the new file
+func WriteFiles(dir string, outputs map[string]bool, snapshot model.Snapshot) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	stamp := snapshot.Time.Format("20060102T150405")
+	if outputs["json"] {
+		byteValue, err := json.MarshalIndent(snapshot, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := writeWithLatest(dir, "godata-"+stamp+".json", "godata-latest.json", byteValue); err != nil {
+			return err
+		}
+	}
+	if outputs["ndjson"] {
+		byteValue, err := snapshotNDJSON(snapshot)
+		if err != nil {
+			return err
+		}
+		if err := writeWithLatest(dir, "godata-"+stamp+".ndjson", "godata-latest.ndjson", byteValue); err != nil {
+			return err
+		}
+	}
+	if outputs["csv"] {
+		if err := writeWithLatest(dir, "godata-"+stamp+"-pools.csv", "godata-latest-pools.csv", poolsCSV(snapshot)); err != nil {
+			return err
+		}
+		if err := writeWithLatest(dir, "godata-"+stamp+"-clients.csv", "godata-latest-clients.csv", clientsCSV(snapshot)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeWithLatest(dir, filename, latest string, byteValue []byte) error {
+	path := filepath.Join(dir, filename)
+	temp := path + ".tmp"
+	if err := os.WriteFile(temp, byteValue, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(temp, path); err != nil {
+		return err
+	}
+	// replace the symlink atomically so readers never see it missing
+	link := filepath.Join(dir, latest)
+	tempLink := link + ".tmp"
+	os.Remove(tempLink)
+	if err := os.Symlink(filename, tempLink); err != nil {
+		return err
+	}
+	return os.Rename(tempLink, link)
+}
+
+// snapshotNDJSON writes one json object per line with a kind field
+// telling pools, systems and clients apart
+func snapshotNDJSON(snapshot model.Snapshot) ([]byte, error) {
+	var output []byte
+	add := func(kind string, record interface{}) error {
+		byteValue, err := json.Marshal(struct {
+			Kind   string
+			Time   time.Time
+			Record interface{}
+		}{kind, snapshot.Time, record})
+		if err != nil {
+			return err
+		}
+		output = append(append(output, byteValue...), '\n')
+		return nil
+	}
+	for _, pool := range snapshot.Pools {
+		if err := add("pool", pool); err != nil {
+			return nil, err
+		}
+	}
+	for _, system := range snapshot.Systems {
+		if err := add("system", system); err != nil {
+			return nil, err
+		}
+	}
+	for _, client := range snapshot.Clients {
+		if err := add("client", client); err != nil {
+			return nil, err
+		}
+	}
+	return output, nil
+}
+
+func poolsCSV(snapshot model.Snapshot) []byte {
+	var buffer bytes.Buffer
+	w := csv.NewWriter(&buffer)
+	w.Write([]string{"Time", "Array", "Id", "Pool", "Client", "Site", "Type", "Firmware", "Health", "RunningStatus", "TotalCapacity", "FreeCapacity", "UsedCapacity", "AllocationPCT", "WarningPCT", "Stale", "StaleSeconds"})
+	for _, pool := range snapshot.Pools {
+		w.Write([]string{
+			snapshot.Time.Format(time.RFC3339),
+			pool.ArrayName,
+			pool.Id,
+			pool.PoolName,
+			pool.Client,
+			pool.Site,
+			pool.Type,
+			pool.Firmware,
+			pool.Health,
+			pool.RunningStatus,
+			fmt.Sprintf("%f", pool.PoolCapacity),
+			fmt.Sprintf("%f", pool.PoolCapacityFree),
+			fmt.Sprintf("%f", pool.PoolCapacityUsed),
+			fmt.Sprintf("%f", pool.PoolCapacityPCT),
+			fmt.Sprintf("%f", pool.WarningPCT),
+			strconv.FormatBool(pool.Stale),
+			fmt.Sprintf("%f", pool.StaleSeconds),
+		})
+	}
+	w.Flush()
+	return buffer.Bytes()
+}
+
+func clientsCSV(snapshot model.Snapshot) []byte {
+	var buffer bytes.Buffer
+	w := csv.NewWriter(&buffer)
+	w.Write([]string{"Time", "Client", "Total", "TotalFree", "P16Total", "P16Free", "Z141Total", "Z141Free", "StretchedP16Total", "StretchedP16Free", "StretchedZ141Total", "StretchedZ141Free", "UnhealthyPools", "UnhealthyCapacity", "ArraysExpected", "ArraysReporting"})
+	for _, client := range snapshot.Clients {
+		w.Write([]string{
+			snapshot.Time.Format(time.RFC3339),
+			client.Name,
+			fmt.Sprintf("%f", client.Total),
+			fmt.Sprintf("%f", client.TotalFree),
+			fmt.Sprintf("%f", client.P16Total),
+			fmt.Sprintf("%f", client.P16Free),
+			fmt.Sprintf("%f", client.Z141Total),
+			fmt.Sprintf("%f", client.Z141Free),
+			fmt.Sprintf("%f", client.StretchedP16Total),
+			fmt.Sprintf("%f", client.StretchedP16Free),
+			fmt.Sprintf("%f", client.StretchedZ141Total),
+			fmt.Sprintf("%f", client.StretchedZ141Free),
+			strconv.Itoa(client.UnhealthyPools),
+			fmt.Sprintf("%f", client.UnhealthyCapacity),
+			strconv.Itoa(client.ArraysExpected),
+			strconv.Itoa(client.ArraysReporting),
+		})
+	}
+	w.Flush()
+	return buffer.Bytes()
+}
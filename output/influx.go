@@ -0,0 +1,132 @@
+// Package output writes a run to influx, stdout, files and prometheus.
+package output
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"dataCollection/collector"
+	"dataCollection/model"
+)
+
+// EscapeTag escapes the characters influx line protocol does not allow in tag values
+func EscapeTag(value string) string {
+	return strings.NewReplacer(",", "\\,", "=", "\\=", " ", "\\ ").Replace(value)
+}
+
+// Tags builds the tag part of a line from key, value pairs and skips empty values
+func Tags(pairs ...string) string {
+	var tags string
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if pairs[i+1] != "" {
+			tags += "," + pairs[i] + "=" + EscapeTag(pairs[i+1])
+		}
+	}
+	return tags
+}
+
+// WriteInflux posts pools, systems and client rollups to influx as line protocol
+func WriteInflux(url string, pools model.Pools, systems []model.System, clients []model.Client, ts string) error {
+	var lines []string
+	for _, pool := range pools.Pools {
+		totalString := "testData,ID=\"" + pool.Id + pool.ArrayName + ",site=" + pool.Site + ",type=" + pool.Type + " Array=\"" + EscapeField(pool.ArrayName) + "\",Client=\"" + EscapeField(pool.Client) + "\",Firmware=\"" + EscapeField(pool.Firmware) + "\",Pool=\"" + EscapeField(pool.PoolName) + "\",PoolId=\"" + EscapeField(pool.Id) + "\",TotalCapacity=" + fmt.Sprintf("%f", pool.PoolCapacity) + ",FreeCapacity=" + fmt.Sprintf("%f", pool.PoolCapacityFree) + ",UsedCapacity=" + fmt.Sprintf("%f", pool.PoolCapacityUsed) + ",AllocationPCT=" + fmt.Sprintf("%f", pool.PoolCapacityPCT) + ",Health=\"" + EscapeField(pool.Health) + "\",RunningStatus=\"" + EscapeField(pool.RunningStatus) + "\",Healthy=" + strconv.FormatBool(model.IsHealthy(pool)) + ",Stale=" + strconv.FormatBool(pool.Stale) + ",StaleSeconds=" + fmt.Sprintf("%f", pool.StaleSeconds) + " " + ts
+		lines = append(lines, totalString)
+	}
+	for _, system := range systems {
+		// models without a system health, such as IBM, leave out the fields rather than writing ""
+		health := ""
+		if system.Health != "" {
+			health += ",Health=\"" + EscapeField(system.Health) + "\""
+		}
+		if system.RunningStatus != "" {
+			health += ",RunningStatus=\"" + EscapeField(system.RunningStatus) + "\""
+		}
+		systemString := "systemData" + Tags("array", system.ArrayName, "vendor", system.Vendor, "site", system.Site, "client", system.Client) + " Model=\"" + EscapeField(system.Model) + "\",Serial=\"" + EscapeField(system.Serial) + "\",Firmware=\"" + EscapeField(system.Firmware) + "\",Patch=\"" + EscapeField(system.Patch) + "\",Location=\"" + EscapeField(system.Location) + "\",WWN=\"" + EscapeField(system.WWN) + "\"" + health + ",TotalCapacity=" + fmt.Sprintf("%f", system.TotalCapacity) + ",HighWaterLevel=" + fmt.Sprintf("%f", system.HighWaterLevel) + ",LowWaterLevel=" + fmt.Sprintf("%f", system.LowWaterLevel) + " " + fmt.Sprint(system.CollectedAt.UnixNano())
+		lines = append(lines, systemString)
+	}
+	for _, client := range clients {
+		clientString := "clientData,client=\"" + client.Name + "\" Total=" + fmt.Sprintf("%f", client.Total) + ",TotalFree=" + fmt.Sprintf("%f", client.TotalFree) + ",P16Total=" + fmt.Sprintf("%f", client.P16Total) + ",P16Free=" + fmt.Sprintf("%f", client.P16Free) + ",Z141Total=" + fmt.Sprintf("%f", client.Z141Total) + ",Z141Free=" + fmt.Sprintf("%f", client.Z141Free) + ",P16InternalTotal=" + fmt.Sprintf("%f", client.P16InternalTotal) + ",P16InternalFree=" + fmt.Sprintf("%f", client.P16InternalFree) + ",P16InternalSSDTotal=" + fmt.Sprintf("%f", client.P16InternalSSDTotal) + ",P16InternalHDDTotal=" + fmt.Sprintf("%f", client.P16InternalHDDTotal) + ",P16InternalSSDFree=" + fmt.Sprintf("%f", client.P16InternalSSDFree) + ",P16InternalHDDFree=" + fmt.Sprintf("%f", client.P16InternalHDDFree) + ",P16InternalSSDMinLun=" + fmt.Sprint(client.P16InternalSSDMinLun) + ",P16InternalHDDMinLun=" + fmt.Sprint(client.P16InternalHDDMinLun) + ",P16ExternalTotal=" + fmt.Sprintf("%f", client.P16ExternalTotal) + ",P16ExternalFree=" + fmt.Sprintf("%f", client.P16ExternalFree) + ",P16ExternalSSDTotal=" + fmt.Sprintf("%f", client.P16ExternalSSDTotal) + ",P16ExternalHDDTotal=" + fmt.Sprintf("%f", client.P16ExternalHDDTotal) + ",P16ExternalSSDFree=" + fmt.Sprintf("%f", client.P16ExternalSSDFree) + ",P16ExternalHDDFree=" + fmt.Sprintf("%f", client.P16ExternalHDDFree) + ",P16ExternalSSDMinLun=" + fmt.Sprint(client.P16ExternalSSDMinLun) + ",P16ExternalHDDMinLun=" + fmt.Sprint(client.P16ExternalHDDMinLun) + ",Z141InternalTotal=" + fmt.Sprintf("%f", client.Z141InternalTotal) + ",Z141InternalFree=" + fmt.Sprintf("%f", client.Z141InternalFree) + ",Z141InternalSSDTotal=" + fmt.Sprintf("%f", client.Z141InternalSSDTotal) + ",Z141InternalHDDTotal=" + fmt.Sprintf("%f", client.Z141InternalHDDTotal) + ",Z141InternalSSDFree=" + fmt.Sprintf("%f", client.Z141InternalSSDFree) + ",Z141InternalHDDFree=" + fmt.Sprintf("%f", client.Z141InternalHDDFree) + ",Z141InternalSSDMinLun=" + fmt.Sprint(client.Z141InternalSSDMinLun) + ",Z141InternalHDDMinLun=" + fmt.Sprint(client.Z141InternalHDDMinLun) + ",Z141ExternalTotal=" + fmt.Sprintf("%f", client.Z141ExternalTotal) + ",Z141ExternalFree=" + fmt.Sprintf("%f", client.Z141ExternalFree) + ",Z141ExternalSSDTotal=" + fmt.Sprintf("%f", client.Z141ExternalSSDTotal) + ",Z141ExternalHDDTotal=" + fmt.Sprintf("%f", client.Z141ExternalHDDTotal) + ",Z141ExternalSSDFree=" + fmt.Sprintf("%f", client.Z141ExternalSSDFree) + ",Z141ExternalHDDFree=" + fmt.Sprintf("%f", client.Z141ExternalHDDFree) + ",Z141ExternalSSDMinLun=" + fmt.Sprint(client.Z141ExternalSSDMinLun) + ",Z141ExternalHDDMinLun=" + fmt.Sprint(client.Z141ExternalHDDMinLun) + ",StretchedP16Total=" + fmt.Sprint(client.StretchedP16Total) + ",StretchedP16Free=" + fmt.Sprint(client.StretchedP16Free) + ",StretchedP16MinLun=" + fmt.Sprint(client.StretchedP16MinLun) + ",StretchedZ141Total=" + fmt.Sprint(client.StretchedZ141Total) + ",StretchedZ141Free=" + fmt.Sprint(client.StretchedZ141Free) + ",StretchedZ141MinLun=" + fmt.Sprint(client.StretchedZ141MinLun) + ",UnhealthyPools=" + fmt.Sprint(client.UnhealthyPools) + ",UnhealthyCapacity=" + fmt.Sprintf("%f", client.UnhealthyCapacity) + ",ArraysExpected=" + fmt.Sprint(client.ArraysExpected) + ",ArraysReporting=" + fmt.Sprint(client.ArraysReporting) + ",Coverage=" + fmt.Sprintf("%f", client.Coverage()) + " " + ts
+		lines = append(lines, clientString)
+	}
+	return PostInflux(url, lines)
+}
+
+func PostInflux(url string, lines []string) error {
+	if len(lines) == 0 {
+		return nil
+	}
+	resp, err := http.Post(url, "application/json; charset=utf-8", bytes.NewBufferString(strings.Join(lines, "\n")))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("influx: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// ChangeLines writes the events to the inventoryEvent measurement, Title, Text
+// and the tags are what grafana annotations read
+func ChangeLines(events []model.ChangeEvent) []string {
+	var lines []string
+	for _, e := range events {
+		lines = append(lines, "inventoryEvent"+Tags("array", e.Array, "site", e.Site, "client", e.Client, "kind", e.Kind, "pool", e.PoolId)+
+			" Title=\""+EscapeField(e.Title())+"\""+
+			",Text=\""+EscapeField(e.Text())+"\""+
+			",Pool=\""+EscapeField(e.PoolName)+"\""+
+			",From=\""+EscapeField(e.From)+"\""+
+			",To=\""+EscapeField(e.To)+"\""+
+			",Delta="+fmt.Sprintf("%f", e.Delta)+
+			" "+fmt.Sprint(e.Time.UnixNano()))
+	}
+	return lines
+}
+
+// EscapeField escapes the characters influx line protocol does not allow in string field values
+func EscapeField(value string) string {
+	return strings.NewReplacer("\\", "\\\\", "\"", "\\\"").Replace(value)
+}
+
+// TelemetryLines describes the collector itself: a collectionStatus point per array
+// and a collectionRun point with the totals, so arrays that stop reporting show up
+func TelemetryLines(report collector.RunReport, results []model.ArrayResult, ts string) []string {
+	var lines []string
+	succeeded := 0
+	pools := 0
+	for _, res := range results {
+		class := collector.ErrorClass(res.Err)
+		if res.Err == nil {
+			succeeded++
+		}
+		pools += len(res.Pools.Pools)
+		breaker := ""
+		if res.Breaker != "" {
+			breaker = ",Breaker=\"" + res.Breaker + "\""
+		}
+		lines = append(lines, "collectionStatus"+Tags("array", res.Array.Name, "model", res.Array.Model, "site", res.Array.Site, "client", res.Array.Client, "scope", report.Scope)+
+			" Success="+strconv.FormatBool(res.Err == nil)+
+			",ErrorClass=\""+class+"\""+
+			",Attempts="+strconv.Itoa(res.Attempts)+breaker+
+			",ConnectSeconds="+fmt.Sprintf("%f", res.Stats.ConnectTime.Seconds())+
+			",CommandSeconds="+fmt.Sprintf("%f", res.Stats.CommandTime.Seconds())+
+			",DurationSeconds="+fmt.Sprintf("%f", res.Duration.Seconds())+
+			",OutputBytes="+strconv.Itoa(res.Stats.OutputBytes)+
+			",PoolsParsed="+strconv.Itoa(len(res.Pools.Pools))+
+			" "+ts)
+	}
+	lines = append(lines, "collectionRun"+Tags("scope", report.Scope)+
+		" Status=\""+report.Status+"\""+
+		",Arrays="+strconv.Itoa(len(results))+
+		",Succeeded="+strconv.Itoa(succeeded)+
+		",Failed="+strconv.Itoa(len(results)-succeeded)+
+		",Pools="+strconv.Itoa(pools)+
+		",DurationSeconds="+fmt.Sprintf("%f", report.Duration)+
+		" "+ts)
+	return lines
+}
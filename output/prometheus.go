@@ -0,0 +1,235 @@
+package output
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"dataCollection/model"
+)
+
+// MetricsExporter keeps the latest collected values
+// and serves them in the prometheus text format
+type MetricsExporter struct {
+	mu sync.Mutex
+	// pools and systems are kept per array name, clients per client name
+	pools   map[string][]model.Pool
+	systems map[string]model.System
+	clients map[string]model.Client
+	arrays  map[string]arrayScrape
+	lastRun map[string]time.Time
+}
+
+type arrayScrape struct {
+	Last     time.Time
+	Success  bool
+	Duration time.Duration
+}
+
+func NewMetricsExporter() *MetricsExporter {
+	return &MetricsExporter{
+		pools:   make(map[string][]model.Pool),
+		systems: make(map[string]model.System),
+		clients: make(map[string]model.Client),
+		arrays:  make(map[string]arrayScrape),
+		lastRun: make(map[string]time.Time),
+	}
+}
+
+// Update replaces what the scope of the cycle collected for the arrays in results
+// and keeps the rest, so neither a system schedule nor a schedule of some of the
+// arrays wipes the pools of the other arrays
+func (e *MetricsExporter) Update(scope string, results []model.ArrayResult, pools model.Pools, systems []model.System, clients []model.Client) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if scope != "system" {
+		byArray := make(map[string][]model.Pool)
+		for _, pool := range pools.Pools {
+			byArray[pool.ArrayName] = append(byArray[pool.ArrayName], pool)
+		}
+		for _, res := range results {
+			if arrayPools, ok := byArray[res.Array.Name]; ok {
+				e.pools[res.Array.Name] = arrayPools
+			} else {
+				delete(e.pools, res.Array.Name)
+			}
+		}
+		for _, client := range clients {
+			e.clients[client.Name] = client
+		}
+	}
+	if scope != "capacity" {
+		for _, res := range results {
+			delete(e.systems, res.Array.Name)
+		}
+		for _, system := range systems {
+			e.systems[system.ArrayName] = system
+		}
+	}
+	for _, res := range results {
+		e.arrays[res.Array.Name] = arrayScrape{Last: res.Started, Success: res.Err == nil, Duration: res.Duration}
+	}
+	e.lastRun[scope] = time.Now()
+}
+
+func (e *MetricsExporter) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.Write([]byte(e.render()))
+	})
+	return mux
+}
+
+// metricWriter groups samples per metric name, the text format
+// requires all samples of a metric to follow its HELP and TYPE lines
+type metricWriter struct {
+	names   []string
+	help    map[string]string
+	samples map[string][]string
+}
+
+func newMetricWriter() *metricWriter {
+	return &metricWriter{help: make(map[string]string), samples: make(map[string][]string)}
+}
+
+func (m *metricWriter) gauge(name, help string, value float64, labels ...string) {
+	if _, ok := m.help[name]; !ok {
+		m.names = append(m.names, name)
+		m.help[name] = help
+	}
+	sample := name
+	if len(labels) > 0 {
+		var pairs []string
+		for i := 0; i+1 < len(labels); i += 2 {
+			pairs = append(pairs, labels[i]+"=\""+escapeLabel(labels[i+1])+"\"")
+		}
+		sample += "{" + strings.Join(pairs, ",") + "}"
+	}
+	m.samples[name] = append(m.samples[name], sample+" "+strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+func (m *metricWriter) String() string {
+	var output strings.Builder
+	for _, name := range m.names {
+		output.WriteString("# HELP " + name + " " + m.help[name] + "\n")
+		output.WriteString("# TYPE " + name + " gauge\n")
+		for _, sample := range m.samples[name] {
+			output.WriteString(sample + "\n")
+		}
+	}
+	return output.String()
+}
+
+func escapeLabel(value string) string {
+	return strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n").Replace(value)
+}
+
+func boolGauge(value bool) float64 {
+	if value {
+		return 1
+	}
+	return 0
+}
+
+func (e *MetricsExporter) render() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	m := newMetricWriter()
+
+	var poolArrays, clientNames, systemArrays []string
+	for name := range e.pools {
+		poolArrays = append(poolArrays, name)
+	}
+	for name := range e.clients {
+		clientNames = append(clientNames, name)
+	}
+	for name := range e.systems {
+		systemArrays = append(systemArrays, name)
+	}
+	sort.Strings(poolArrays)
+	sort.Strings(clientNames)
+	sort.Strings(systemArrays)
+
+	var pools []model.Pool
+	for _, name := range poolArrays {
+		pools = append(pools, e.pools[name]...)
+	}
+	for _, pool := range pools {
+		labels := []string{"array", pool.ArrayName, "pool", pool.PoolName, "pool_id", pool.Id, "site", pool.Site, "type", pool.Type, "client", pool.Client, "firmware", pool.Firmware}
+		m.gauge("godata_pool_capacity_bytes", "Total capacity of the pool.", pool.PoolCapacity, labels...)
+		m.gauge("godata_pool_free_bytes", "Free capacity of the pool.", pool.PoolCapacityFree, labels...)
+		m.gauge("godata_pool_used_bytes", "Used capacity of the pool.", pool.PoolCapacityUsed, labels...)
+		m.gauge("godata_pool_used_ratio", "Used capacity divided by total capacity.", pool.PoolCapacityPCT, labels...)
+		m.gauge("godata_pool_warning_ratio", "Warning level configured on the array, 0 when unset.", pool.WarningPCT/100, labels...)
+		m.gauge("godata_pool_healthy", "1 when the pool is online and in a normal state.", boolGauge(model.IsHealthy(pool)), labels...)
+		m.gauge("godata_pool_stale_seconds", "Age of carried forward data of an unreachable array, 0 when fresh.", pool.StaleSeconds, labels...)
+	}
+
+	for _, name := range clientNames {
+		client := e.clients[name]
+		m.gauge("godata_client_capacity_bytes", "Total capacity of all pools of the client.", client.Total, "client", client.Name)
+		m.gauge("godata_client_free_bytes", "Free capacity of all pools of the client.", client.TotalFree, "client", client.Name)
+		sites := []struct {
+			site        string
+			total, free float64
+		}{
+			{"P16", client.P16Total, client.P16Free},
+			{"Z141", client.Z141Total, client.Z141Free},
+		}
+		for _, site := range sites {
+			m.gauge("godata_client_site_capacity_bytes", "Total capacity of the client per site.", site.total, "client", client.Name, "site", site.site)
+			m.gauge("godata_client_site_free_bytes", "Free capacity of the client per site.", site.free, "client", client.Name, "site", site.site)
+		}
+		tiers := []struct {
+			site, location, tier string
+			total, free          float64
+		}{
+			{"P16", "internal", "ssd", client.P16InternalSSDTotal, client.P16InternalSSDFree},
+			{"P16", "internal", "hdd", client.P16InternalHDDTotal, client.P16InternalHDDFree},
+			{"P16", "external", "ssd", client.P16ExternalSSDTotal, client.P16ExternalSSDFree},
+			{"P16", "external", "hdd", client.P16ExternalHDDTotal, client.P16ExternalHDDFree},
+			{"Z141", "internal", "ssd", client.Z141InternalSSDTotal, client.Z141InternalSSDFree},
+			{"Z141", "internal", "hdd", client.Z141InternalHDDTotal, client.Z141InternalHDDFree},
+			{"Z141", "external", "ssd", client.Z141ExternalSSDTotal, client.Z141ExternalSSDFree},
+			{"Z141", "external", "hdd", client.Z141ExternalHDDTotal, client.Z141ExternalHDDFree},
+		}
+		for _, tier := range tiers {
+			m.gauge("godata_client_tier_capacity_bytes", "Total capacity of the client per site, location and tier.", tier.total, "client", client.Name, "site", tier.site, "location", tier.location, "tier", tier.tier)
+			m.gauge("godata_client_tier_free_bytes", "Free capacity of the client per site, location and tier.", tier.free, "client", client.Name, "site", tier.site, "location", tier.location, "tier", tier.tier)
+		}
+		m.gauge("godata_client_unhealthy_pools", "Number of client pools that are not healthy.", float64(client.UnhealthyPools), "client", client.Name)
+		m.gauge("godata_client_arrays_expected", "Number of client arrays in the inventory.", float64(client.ArraysExpected), "client", client.Name)
+		m.gauge("godata_client_arrays_reporting", "Number of client arrays collected this run.", float64(client.ArraysReporting), "client", client.Name)
+	}
+
+	for _, name := range systemArrays {
+		system := e.systems[name]
+		m.gauge("godata_system_info", "Inventory details of the array.", 1, "array", system.ArrayName, "vendor", system.Vendor, "model", system.Model, "serial", system.Serial, "firmware", system.Firmware, "patch", system.Patch, "site", system.Site, "client", system.Client)
+		m.gauge("godata_system_capacity_bytes", "Total capacity reported by the array.", system.TotalCapacity, "array", system.ArrayName)
+	}
+
+	names := make([]string, 0, len(e.arrays))
+	for name := range e.arrays {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		scrape := e.arrays[name]
+		m.gauge("godata_array_last_scrape_timestamp_seconds", "Time the array was last collected.", float64(scrape.Last.Unix()), "array", name)
+		m.gauge("godata_array_scrape_success", "1 when the last collection of the array succeeded.", boolGauge(scrape.Success), "array", name)
+		m.gauge("godata_array_scrape_duration_seconds", "Duration of the last collection of the array.", scrape.Duration.Seconds(), "array", name)
+	}
+	scopes := make([]string, 0, len(e.lastRun))
+	for scope := range e.lastRun {
+		scopes = append(scopes, scope)
+	}
+	sort.Strings(scopes)
+	for _, scope := range scopes {
+		m.gauge("godata_last_run_timestamp_seconds", "Time the last cycle of the scope finished.", float64(e.lastRun[scope].Unix()), "scope", scope)
+	}
+	return m.String()
+}
@@ -0,0 +1,38 @@
+package output
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"dataCollection/model"
+)
+
+func PrintResults(pools model.Pools, systems []model.System, clients []model.Client) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	if len(systems) > 0 {
+		fmt.Fprintln(w, "ARRAY\tVENDOR\tMODEL\tSERIAL\tFIRMWARE\tPATCH\tHEALTH\tTOTAL TB")
+		for _, system := range systems {
+			fmt.Fprintln(w, system.ArrayName+"\t"+system.Vendor+"\t"+system.Model+"\t"+system.Serial+"\t"+system.Firmware+"\t"+system.Patch+"\t"+system.Health+"\t"+model.Terabytes(system.TotalCapacity))
+		}
+		fmt.Fprintln(w)
+	}
+	fmt.Fprintln(w, "ARRAY\tID\tPOOL\tCLIENT\tSITE\tTYPE\tHEALTH\tTOTAL TB\tFREE TB\tUSED %\tSTALE")
+	for _, pool := range pools.Pools {
+		stale := ""
+		if pool.Stale {
+			stale = (time.Duration(pool.StaleSeconds) * time.Second).String()
+		}
+		fmt.Fprintln(w, pool.ArrayName+"\t"+pool.Id+"\t"+pool.PoolName+"\t"+pool.Client+"\t"+pool.Site+"\t"+pool.Type+"\t"+pool.Health+"\t"+model.Terabytes(pool.PoolCapacity)+"\t"+model.Terabytes(pool.PoolCapacityFree)+"\t"+fmt.Sprintf("%.1f", pool.PoolCapacityPCT*100)+"\t"+stale)
+	}
+	if len(clients) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "CLIENT\tTOTAL TB\tFREE TB\tP16 TB\tZ141 TB\tUNHEALTHY POOLS\tARRAYS REPORTING")
+		for _, client := range clients {
+			fmt.Fprintln(w, client.Name+"\t"+model.Terabytes(client.Total)+"\t"+model.Terabytes(client.TotalFree)+"\t"+model.Terabytes(client.P16Total)+"\t"+model.Terabytes(client.Z141Total)+"\t"+strconv.Itoa(client.UnhealthyPools)+"\t"+strconv.Itoa(client.ArraysReporting)+"/"+strconv.Itoa(client.ArraysExpected))
+		}
+	}
+	w.Flush()
+}
@@ -0,0 +1,164 @@
+// Package store keeps every run in a local bbolt file.
+package store
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"dataCollection/forecast"
+	"dataCollection/model"
+)
+
+var runsBucket = []byte("runs")
+
+// Store keeps every run as a Snapshot in a local bbolt file, keyed by the
+// run time so runs can be read back in order without influx
+type Store struct {
+	Path string
+}
+
+func runKey(t time.Time) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(t.UnixNano()))
+	return key
+}
+
+func keyTime(key []byte) time.Time {
+	return time.Unix(0, int64(binary.BigEndian.Uint64(key)))
+}
+
+// open is done per operation so queries from the command line
+// do not wait for a running daemon to release the file
+func (s Store) open(readOnly bool) (*bolt.DB, error) {
+	if readOnly {
+		if _, err := os.Stat(s.Path); err != nil {
+			return nil, err
+		}
+	}
+	return bolt.Open(s.Path, 0644, &bolt.Options{Timeout: 10 * time.Second, ReadOnly: readOnly})
+}
+
+// Save adds the snapshot of a run
+func (s Store) Save(snapshot model.Snapshot) error {
+	db, err := s.open(false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	byteValue, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	return db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(runsBucket)
+		if err != nil {
+			return err
+		}
+		return bucket.Put(runKey(snapshot.Time), byteValue)
+	})
+}
+
+// Compact removes runs older than retention and keeps only the last run of
+// every day, scope and schedule for runs older than raw
+func (s Store) Compact(raw, retention time.Duration, now time.Time) (removed int, err error) {
+	db, err := s.open(false)
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+	err = db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(runsBucket)
+		if bucket == nil {
+			return nil
+		}
+		var remove [][]byte
+		lastOfDay := make(map[string][]byte)
+		rawStart := now.Add(-raw)
+		retentionStart := now.Add(-retention)
+		cursor := bucket.Cursor()
+		for key, value := cursor.First(); key != nil; key, value = cursor.Next() {
+			t := keyTime(key)
+			if retention > 0 && t.Before(retentionStart) {
+				remove = append(remove, append([]byte(nil), key...))
+				continue
+			}
+			if !t.Before(rawStart) {
+				break
+			}
+			// a system run or a schedule of some arrays only must not replace
+			// the last full run of the day, every kind of run keeps its own
+			var kind struct {
+				Scope    string
+				Schedule string
+			}
+			if err := json.Unmarshal(value, &kind); err != nil {
+				return fmt.Errorf("run %s: %s", t.Format(time.RFC3339), err.Error())
+			}
+			day := t.Format("20060102") + "/" + kind.Scope + "/" + kind.Schedule
+			if previous, ok := lastOfDay[day]; ok {
+				remove = append(remove, previous)
+			}
+			lastOfDay[day] = append([]byte(nil), key...)
+		}
+		for _, key := range remove {
+			if err := bucket.Delete(key); err != nil {
+				return err
+			}
+		}
+		removed = len(remove)
+		return nil
+	})
+	return removed, err
+}
+
+// Runs returns the snapshots taken at or after since, oldest first
+func (s Store) Runs(since time.Time) ([]model.Snapshot, error) {
+	var snapshots []model.Snapshot
+	db, err := s.open(true)
+	if os.IsNotExist(err) {
+		return snapshots, nil
+	}
+	if err != nil {
+		return snapshots, err
+	}
+	defer db.Close()
+	err = db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(runsBucket)
+		if bucket == nil {
+			return nil
+		}
+		cursor := bucket.Cursor()
+		key, value := cursor.First()
+		if !since.IsZero() {
+			key, value = cursor.Seek(runKey(since))
+		}
+		for ; key != nil; key, value = cursor.Next() {
+			var snapshot model.Snapshot
+			if err := json.Unmarshal(value, &snapshot); err != nil {
+				return fmt.Errorf("run %s: %s", keyTime(key).Format(time.RFC3339), err.Error())
+			}
+			snapshots = append(snapshots, snapshot)
+		}
+		return nil
+	})
+	return snapshots, err
+}
+
+// Samples makes the store usable as forecast history
+func (s Store) Samples(since time.Time) ([]forecast.Sample, error) {
+	var output []forecast.Sample
+	snapshots, err := s.Runs(since)
+	for _, snapshot := range snapshots {
+		for _, pool := range snapshot.Pools {
+			if !pool.Stale {
+				output = append(output, forecast.SampleFromPool(pool, snapshot.Time))
+			}
+		}
+	}
+	return output, err
+}
@@ -0,0 +1,121 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"dataCollection/model"
+)
+
+func TestCompact(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	day := func(days, hour int) time.Time {
+		return time.Date(2026, 10, 19-days, hour, 0, 0, 0, time.UTC)
+	}
+	run := func(t time.Time, scope, schedule string, pools int) model.Snapshot {
+		snapshot := model.Snapshot{Time: t, Scope: scope, Schedule: schedule}
+		for i := 0; i < pools; i++ {
+			snapshot.Pools = append(snapshot.Pools, model.Pool{ArrayName: "A", Id: string(rune('0' + i))})
+		}
+		return snapshot
+	}
+	tests := []struct {
+		name      string
+		runs      []model.Snapshot
+		raw       time.Duration
+		retention time.Duration
+		removed   int
+		kept      []time.Time
+	}{
+		{
+			name:    "last run of an old day is kept",
+			runs:    []model.Snapshot{run(day(3, 8), "all", "all", 2), run(day(3, 9), "all", "all", 2), run(day(3, 10), "all", "all", 2)},
+			raw:     48 * time.Hour,
+			removed: 2,
+			kept:    []time.Time{day(3, 10)},
+		},
+		{
+			name: "a later system run does not replace the capacity run",
+			runs: []model.Snapshot{
+				run(day(3, 8), "all", "capacity", 2),
+				run(day(3, 9), "all", "capacity", 2),
+				run(day(3, 22), "system", "inventory", 0),
+			},
+			raw:     48 * time.Hour,
+			removed: 1,
+			kept:    []time.Time{day(3, 9), day(3, 22)},
+		},
+		{
+			name: "a schedule of some arrays keeps its own run",
+			runs: []model.Snapshot{
+				run(day(3, 8), "all", "all", 2),
+				run(day(3, 20), "pools", "tier1", 1),
+				run(day(3, 21), "pools", "tier1", 1),
+			},
+			raw:     48 * time.Hour,
+			removed: 1,
+			kept:    []time.Time{day(3, 8), day(3, 21)},
+		},
+		{
+			name:    "raw runs are untouched",
+			runs:    []model.Snapshot{run(day(0, 8), "all", "all", 2), run(day(0, 9), "system", "inventory", 0), run(day(0, 10), "all", "all", 2)},
+			raw:     48 * time.Hour,
+			removed: 0,
+			kept:    []time.Time{day(0, 8), day(0, 9), day(0, 10)},
+		},
+		{
+			name:      "runs older than retention are removed",
+			runs:      []model.Snapshot{run(day(40, 8), "all", "all", 2), run(day(3, 8), "all", "all", 2)},
+			raw:       48 * time.Hour,
+			retention: 30 * 24 * time.Hour,
+			removed:   1,
+			kept:      []time.Time{day(3, 8)},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := Store{Path: filepath.Join(t.TempDir(), "godata.db")}
+			for _, snapshot := range test.runs {
+				if err := store.Save(snapshot); err != nil {
+					t.Fatal(err)
+				}
+			}
+			removed, err := store.Compact(test.raw, test.retention, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if removed != test.removed {
+				t.Errorf("removed %d runs, want %d", removed, test.removed)
+			}
+			snapshots, err := store.Runs(time.Time{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(snapshots) != len(test.kept) {
+				t.Fatalf("%d runs kept, want %d", len(snapshots), len(test.kept))
+			}
+			for i, snapshot := range snapshots {
+				if !snapshot.Time.Equal(test.kept[i]) {
+					t.Errorf("run %d is %s, want %s", i, snapshot.Time.Format(time.RFC3339), test.kept[i].Format(time.RFC3339))
+				}
+			}
+		})
+	}
+}
+
+func TestSamplesSkipStale(t *testing.T) {
+	store := Store{Path: filepath.Join(t.TempDir(), "godata.db")}
+	now := time.Now()
+	err := store.Save(model.Snapshot{Time: now, Scope: "all", Pools: []model.Pool{{ArrayName: "A", Id: "0"}, {ArrayName: "B", Id: "0", Stale: true}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	samples, err := store.Samples(time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) != 1 || samples[0].ArrayName != "A" {
+		t.Errorf("samples %+v, want only the fresh pool of A", samples)
+	}
+}
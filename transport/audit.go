@@ -0,0 +1,161 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrNotAllowed is returned for a command that is not on the allowlist of its model,
+// such a command is never sent to the array
+var ErrNotAllowed = errors.New("command not allowed")
+
+// ErrAuditFailed is returned for a command that was not sent because its audit
+// record could not be written
+var ErrAuditFailed = errors.New("audit log not writable")
+
+// audit statuses of a command, started is written before a command is sent
+// and one of the others once it is done
+const (
+	AuditStarted     = "started"
+	AuditOK          = "ok"
+	AuditFailed      = "failed"
+	AuditTimeout     = "timeout"
+	AuditOutputLimit = "output_limit"
+	AuditDenied      = "denied"
+)
+
+// AuditRecord struct which contains one command sent
+// to an array, or refused before it was sent
+type AuditRecord struct {
+	Time       time.Time `json:"time"`
+	Array      string    `json:"array"`
+	Host       string    `json:"host"`
+	User       string    `json:"user"`
+	Command    string    `json:"command"`
+	Duration   float64   `json:"duration_seconds"`
+	ExitStatus int       `json:"exit_status"`
+	Status     string    `json:"status"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// AuditLog appends one json line per command to Filename. The file is
+// only ever opened for appending and is readable by its owner only
+type AuditLog struct {
+	Filename string
+
+	mu sync.Mutex
+}
+
+// Check creates the file when it is missing, so a log that cannot
+// be written stops a run before any command is sent
+func (a *AuditLog) Check() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	file, err := os.OpenFile(a.Filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// Write appends a record in a single write
+func (a *AuditLog) Write(record AuditRecord) error {
+	byteValue, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	file, err := os.OpenFile(a.Filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(byteValue, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Guard is a Runner that refuses every command Allow rejects and writes
+// every command, refused or run, to Audit when it is set. A command is only
+// sent once its started record is written, so none runs without a trace
+type Guard struct {
+	Runner Runner
+	Allow  func(command string) error
+	Audit  *AuditLog
+	Array  string
+	Host   string
+	User   string
+}
+
+func (g Guard) Run(ctx context.Context, command string) ([]byte, []byte, error) {
+	started := time.Now()
+	if err := g.Allow(command); err != nil {
+		err = fmt.Errorf("%w: %v", ErrNotAllowed, err)
+		g.audit(started, command, err)
+		return nil, nil, err
+	}
+	if g.Audit != nil {
+		record := g.record(started, command)
+		record.Status = AuditStarted
+		if err := g.Audit.Write(record); err != nil {
+			slog.Error("writing audit log failed, command not sent", "array", g.Array, "phase", "audit", "command", command, "error", err)
+			return nil, nil, fmt.Errorf("%s: %w: %v", command, ErrAuditFailed, err)
+		}
+	}
+	stdout, stderr, err := g.Runner.Run(ctx, command)
+	g.audit(started, command, err)
+	return stdout, stderr, err
+}
+
+func (g Guard) record(started time.Time, command string) AuditRecord {
+	return AuditRecord{
+		Time:    started,
+		Array:   g.Array,
+		Host:    g.Host,
+		User:    g.User,
+		Command: command,
+	}
+}
+
+// audit writes how a command ended, it already ran so a failed write is only logged
+func (g Guard) audit(started time.Time, command string, err error) {
+	if g.Audit == nil {
+		return
+	}
+	record := g.record(started, command)
+	record.Duration = time.Since(started).Seconds()
+	record.Status = AuditOK
+	var commandErr *CommandError
+	switch {
+	case err == nil:
+	case errors.As(err, &commandErr):
+		record.ExitStatus = commandErr.ExitStatus
+		record.Status = AuditFailed
+	case errors.Is(err, ErrNotAllowed):
+		record.ExitStatus = -1
+		record.Status = AuditDenied
+	case errors.Is(err, ErrTimeout):
+		record.ExitStatus = -1
+		record.Status = AuditTimeout
+	case errors.Is(err, ErrOutputLimit):
+		record.ExitStatus = -1
+		record.Status = AuditOutputLimit
+	default:
+		record.ExitStatus = -1
+		record.Status = AuditFailed
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	if err := g.Audit.Write(record); err != nil {
+		slog.Error("writing audit log failed", "array", g.Array, "phase", "audit", "command", command, "error", err)
+	}
+}
@@ -0,0 +1,113 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runnerFunc answers every command with run
+type runnerFunc func(ctx context.Context, command string) ([]byte, []byte, error)
+
+func (f runnerFunc) Run(ctx context.Context, command string) ([]byte, []byte, error) {
+	return f(ctx, command)
+}
+
+func readRecords(t *testing.T, filename string) []AuditRecord {
+	byteValue, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records []AuditRecord
+	for _, line := range strings.Split(strings.TrimSpace(string(byteValue)), "\n") {
+		var record AuditRecord
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestGuard(t *testing.T) {
+	allow := func(command string) error {
+		if strings.HasPrefix(command, "ls") {
+			return nil
+		}
+		return fmt.Errorf("%q is not read-only", command)
+	}
+	tests := []struct {
+		name     string
+		command  string
+		err      error
+		statuses []string
+		exit     int
+	}{
+		{name: "ok", command: "lssystem", statuses: []string{AuditStarted, AuditOK}},
+		{name: "failed", command: "lsmdiskgrp", err: &CommandError{Command: "lsmdiskgrp", ExitStatus: 1}, statuses: []string{AuditStarted, AuditFailed}, exit: 1},
+		{name: "timeout", command: "lsvdisk", err: ErrTimeout, statuses: []string{AuditStarted, AuditTimeout}, exit: -1},
+		{name: "output limit", command: "lsvdisk", err: ErrOutputLimit, statuses: []string{AuditStarted, AuditOutputLimit}, exit: -1},
+		{name: "denied", command: "rmmdiskgrp 0", statuses: []string{AuditDenied}, exit: -1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			audit := &AuditLog{Filename: filepath.Join(t.TempDir(), "audit.log")}
+			sent := 0
+			guard := Guard{
+				Runner: runnerFunc(func(ctx context.Context, command string) ([]byte, []byte, error) {
+					sent++
+					// the command is on record before it reaches the array
+					if records := readRecords(t, audit.Filename); len(records) != 1 || records[0].Status != AuditStarted {
+						t.Errorf("records %+v when the command was sent, want one started", records)
+					}
+					return nil, nil, test.err
+				}),
+				Allow: allow,
+				Audit: audit,
+				Array: "A",
+				User:  "monitor",
+			}
+			guard.Run(context.Background(), test.command)
+			if want := len(test.statuses) - 1; sent != want {
+				t.Errorf("command sent %d times, want %d", sent, want)
+			}
+			records := readRecords(t, audit.Filename)
+			if len(records) != len(test.statuses) {
+				t.Fatalf("%d records, want %d", len(records), len(test.statuses))
+			}
+			for i, record := range records {
+				if record.Status != test.statuses[i] || record.Command != test.command || record.Array != "A" || record.User != "monitor" {
+					t.Errorf("record %d is %+v, want status %s", i, record, test.statuses[i])
+				}
+			}
+			if last := records[len(records)-1]; last.ExitStatus != test.exit {
+				t.Errorf("exit status %d, want %d", last.ExitStatus, test.exit)
+			}
+		})
+	}
+}
+
+func TestGuardUnwritableAudit(t *testing.T) {
+	audit := &AuditLog{Filename: filepath.Join(t.TempDir(), "missing", "audit.log")}
+	sent := false
+	guard := Guard{
+		Runner: runnerFunc(func(ctx context.Context, command string) ([]byte, []byte, error) {
+			sent = true
+			return nil, nil, nil
+		}),
+		Allow: func(string) error { return nil },
+		Audit: audit,
+	}
+	_, _, err := guard.Run(context.Background(), "lssystem")
+	if !errors.Is(err, ErrAuditFailed) {
+		t.Errorf("error %v, want ErrAuditFailed", err)
+	}
+	if sent {
+		t.Error("command sent without an audit record")
+	}
+}
@@ -0,0 +1,222 @@
+// Package rest runs the array commands as GET requests against the REST api
+// of arrays that offer one, such as NetApp ONTAP, and returns the json.
+package rest
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"dataCollection/model"
+	"dataCollection/transport"
+)
+
+// defaults of a Runner without limits, the same as over ssh
+const (
+	DefaultTimeout   = 2 * time.Minute
+	DefaultMaxOutput = 16 << 20
+	defaultPort      = 443
+)
+
+// Runner answers a command with a GET of its path in Paths. Only GET is ever
+// sent and a command without a path is refused, so nothing can change the array
+type Runner struct {
+	BaseURL  string
+	User     string
+	Password string
+	Paths    map[string]string
+	Client   *http.Client
+	// Timeout and MaxOutput limit every request, 0 uses the defaults
+	Timeout   time.Duration
+	MaxOutput int
+}
+
+// NewRunner returns a runner for the api of host, which may carry a port,
+// trusting the certificate authorities of the options on top of the system ones
+func NewRunner(host, user, password string, options *model.RESTOptions, paths map[string]string) (Runner, error) {
+	if options == nil {
+		options = &model.RESTOptions{}
+	}
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		port := options.Port
+		if port == 0 {
+			port = defaultPort
+		}
+		host = net.JoinHostPort(host, strconv.Itoa(port))
+	}
+	config := &tls.Config{InsecureSkipVerify: options.Insecure}
+	if options.CAFile != "" {
+		pem, err := ioutil.ReadFile(options.CAFile)
+		if err != nil {
+			return Runner{}, err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return Runner{}, fmt.Errorf("%s: no certificates found", options.CAFile)
+		}
+		config.RootCAs = pool
+	}
+	httpTransport := http.DefaultTransport.(*http.Transport).Clone()
+	httpTransport.TLSClientConfig = config
+	return Runner{
+		BaseURL:  "https://" + host,
+		User:     user,
+		Password: password,
+		Paths:    paths,
+		Client:   &http.Client{Transport: httpTransport},
+	}, nil
+}
+
+func (r Runner) Run(ctx context.Context, command string) ([]byte, []byte, error) {
+	path, ok := r.Paths[command]
+	if !ok {
+		return nil, nil, fmt.Errorf("%s: %w: no api path", command, transport.ErrNotAllowed)
+	}
+	timeout := r.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	maxOutput := r.maxOutput()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	timedOut := func(err error) error {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("%s: %w after %s", command, transport.ErrTimeout, timeout)
+		}
+		return fmt.Errorf("%s: %w", command, err)
+	}
+
+	body, stderr, err := r.get(ctx, command, path, maxOutput, timedOut)
+	if err != nil {
+		return nil, stderr, err
+	}
+	// a listing longer than one page links to the rest, every page is fetched so
+	// a pool on a later page is not taken for removed
+	prefix := strings.SplitN(path, "?", 2)[0]
+	fetched := map[string]bool{path: true}
+	for {
+		var page struct {
+			Links struct {
+				Next struct {
+					Href string `json:"href"`
+				} `json:"next"`
+			} `json:"_links"`
+		}
+		if json.Unmarshal(body, &page) != nil || page.Links.Next.Href == "" {
+			return body, nil, nil
+		}
+		next := page.Links.Next.Href
+		if strings.SplitN(next, "?", 2)[0] != prefix {
+			return nil, nil, fmt.Errorf("%s: next page %s is not below %s", command, next, prefix)
+		}
+		if fetched[next] {
+			return nil, nil, fmt.Errorf("%s: next page %s was already fetched", command, next)
+		}
+		fetched[next] = true
+		nextBody, stderr, err := r.get(ctx, command, next, maxOutput-len(body), timedOut)
+		if err != nil {
+			return nil, stderr, err
+		}
+		body, err = appendRecords(body, nextBody)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", command, err)
+		}
+	}
+}
+
+// get sends one GET of path and returns the body of a 200 answer
+func (r Runner) get(ctx context.Context, command, path string, maxOutput int, timedOut func(error) error) ([]byte, []byte, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, r.BaseURL+path, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	request.SetBasicAuth(r.User, r.Password)
+	request.Header.Set("Accept", "application/json")
+	client := r.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, nil, timedOut(err)
+	}
+	defer response.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(response.Body, int64(maxOutput)+1))
+	if err != nil {
+		return nil, nil, timedOut(err)
+	}
+	if len(body) > maxOutput {
+		return nil, nil, fmt.Errorf("%s: %w of %d bytes", command, transport.ErrOutputLimit, r.maxOutput())
+	}
+	switch {
+	case response.StatusCode == http.StatusUnauthorized || response.StatusCode == http.StatusForbidden:
+		return nil, body, fmt.Errorf("%s: %w: %s", command, transport.ErrUnauthorized, response.Status)
+	case response.StatusCode != http.StatusOK:
+		return nil, body, &transport.CommandError{Command: command, ExitStatus: response.StatusCode, Stderr: strings.TrimSpace(response.Status + " " + apiError(body))}
+	}
+	return body, nil, nil
+}
+
+func (r Runner) maxOutput() int {
+	if r.MaxOutput <= 0 {
+		return DefaultMaxOutput
+	}
+	return r.MaxOutput
+}
+
+// appendRecords adds the records of the next page to the listing so far, which
+// then counts all of them in num_records and links to the page after the next
+func appendRecords(listing, next []byte) ([]byte, error) {
+	var merged, page map[string]json.RawMessage
+	if err := json.Unmarshal(listing, &merged); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(next, &page); err != nil {
+		return nil, err
+	}
+	var records, pageRecords []json.RawMessage
+	if err := json.Unmarshal(merged["records"], &records); err != nil {
+		return nil, fmt.Errorf("records: %w", err)
+	}
+	if err := json.Unmarshal(page["records"], &pageRecords); err != nil {
+		return nil, fmt.Errorf("records of the next page: %w", err)
+	}
+	records = append(records, pageRecords...)
+	var err error
+	if merged["records"], err = json.Marshal(records); err != nil {
+		return nil, err
+	}
+	merged["num_records"] = json.RawMessage(strconv.Itoa(len(records)))
+	if links, ok := page["_links"]; ok {
+		merged["_links"] = links
+	} else {
+		delete(merged, "_links")
+	}
+	return json.Marshal(merged)
+}
+
+// apiError is the message of an api error response, {"error": {"message": ...}} on ONTAP
+func apiError(body []byte) string {
+	var response struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(body, &response) != nil {
+		return ""
+	}
+	return response.Error.Message
+}
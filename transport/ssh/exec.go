@@ -0,0 +1,125 @@
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	cryptossh "golang.org/x/crypto/ssh"
+
+	"dataCollection/transport"
+)
+
+// defaults of a Runner without limits
+const (
+	DefaultCommandTimeout = 2 * time.Minute
+	DefaultMaxOutput      = 16 << 20
+)
+
+// Runner runs every command in its own session of a connected client, the
+// session is closed whether the command succeeded, failed or timed out
+type Runner struct {
+	Client *cryptossh.Client
+	// Timeout bounds every command, 0 uses DefaultCommandTimeout
+	Timeout time.Duration
+	// MaxOutput caps stdout and stderr of every command in bytes, 0 uses DefaultMaxOutput
+	MaxOutput int
+}
+
+// Run starts command and waits until it exits, ctx ends, the timeout passes or it
+// writes more than MaxOutput. In the last three cases the command gets a KILL
+// signal and its session is closed without waiting for it
+func (r Runner) Run(ctx context.Context, command string) ([]byte, []byte, error) {
+	timeout := r.Timeout
+	if timeout <= 0 {
+		timeout = DefaultCommandTimeout
+	}
+	maxOutput := r.MaxOutput
+	if maxOutput <= 0 {
+		maxOutput = DefaultMaxOutput
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	session, err := r.Client.NewSession()
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: new session: %w", command, err)
+	}
+	defer session.Close()
+	stdout := &cappedBuffer{max: maxOutput, full: cancel}
+	stderr := &cappedBuffer{max: maxOutput, full: cancel}
+	session.Stdout = stdout
+	session.Stderr = stderr
+	if err := session.Start(command); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", command, err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- session.Wait()
+	}()
+
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		session.Signal(cryptossh.SIGKILL)
+		session.Close()
+		switch {
+		case stdout.over() || stderr.over():
+			err = fmt.Errorf("%s: %w of %d bytes", command, transport.ErrOutputLimit, maxOutput)
+		case errors.Is(ctx.Err(), context.DeadlineExceeded):
+			err = fmt.Errorf("%s: %w after %s", command, transport.ErrTimeout, timeout)
+		default:
+			err = fmt.Errorf("%s: %w", command, ctx.Err())
+		}
+		return stdout.Bytes(), stderr.Bytes(), err
+	}
+	var exitErr *cryptossh.ExitError
+	if stdout.over() || stderr.over() {
+		err = fmt.Errorf("%s: %w of %d bytes", command, transport.ErrOutputLimit, maxOutput)
+	} else if errors.As(err, &exitErr) {
+		err = &transport.CommandError{Command: command, ExitStatus: exitErr.ExitStatus(), Stderr: strings.TrimSpace(string(stderr.Bytes()))}
+	} else if err != nil {
+		err = fmt.Errorf("%s: %w", command, err)
+	}
+	return stdout.Bytes(), stderr.Bytes(), err
+}
+
+// cappedBuffer keeps at most max bytes and calls full once when more arrive,
+// writes never fail so the session keeps reading until it is closed
+type cappedBuffer struct {
+	mu       sync.Mutex
+	buf      bytes.Buffer
+	max      int
+	exceeded bool
+	full     func()
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if room := b.max - b.buf.Len(); len(p) > room {
+		b.buf.Write(p[:room])
+		if !b.exceeded {
+			b.exceeded = true
+			b.full()
+		}
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+func (b *cappedBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]byte(nil), b.buf.Bytes()...)
+}
+
+func (b *cappedBuffer) over() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.exceeded
+}
@@ -0,0 +1,205 @@
+package ssh
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	cryptossh "golang.org/x/crypto/ssh"
+
+	"dataCollection/transport"
+)
+
+// auth methods remembered per host
+const (
+	methodPassword            = "password"
+	methodKeyboardInteractive = "keyboard-interactive"
+)
+
+// keepAliveTimeout is how long a kept connection has to answer a keepalive
+const keepAliveTimeout = 15 * time.Second
+
+// Manager hands out one authenticated connection per host. It remembers which
+// auth method worked for every host and offers that one first on the next dial,
+// with Keep set connections are left open after Release so a daemon reuses them
+type Manager struct {
+	User     string
+	Password string
+	Keep     bool
+	// CommandTimeout and MaxOutput are the limits of the runners it hands out
+	CommandTimeout time.Duration
+	MaxOutput      int
+	// Audit gets every command sent over the connections, nil keeps no log
+	Audit *transport.AuditLog
+
+	mu      sync.Mutex
+	methods map[string]string
+	clients map[string]*cryptossh.Client
+	stop    chan struct{}
+}
+
+// NewManager returns a manager logging in as user, keep leaves
+// connections open between cycles until Close
+func NewManager(user, password string, keep bool) *Manager {
+	return &Manager{
+		User:     user,
+		Password: password,
+		Keep:     keep,
+		methods:  make(map[string]string),
+		clients:  make(map[string]*cryptossh.Client),
+		stop:     make(chan struct{}),
+	}
+}
+
+// Get returns the kept connection of the target host when it still answers,
+// otherwise it dials a new one. The caller owns the connection until Release
+func (m *Manager) Get(ctx context.Context, target Target) (*cryptossh.Client, error) {
+	host := target.Host
+	m.mu.Lock()
+	client := m.clients[host]
+	delete(m.clients, host)
+	m.mu.Unlock()
+	if client != nil {
+		if alive(client) {
+			slog.Debug("reusing connection", "host", host, "phase", "connect")
+			return client, nil
+		}
+		client.Close()
+	}
+	return m.dial(ctx, target)
+}
+
+// Runner runs commands over client with the limits of the manager
+func (m *Manager) Runner(client *cryptossh.Client) Runner {
+	return Runner{Client: client, Timeout: m.CommandTimeout, MaxOutput: m.MaxOutput}
+}
+
+// Release hands a connection back. It is closed unless the manager keeps
+// connections, and always when failed is set, since a command that failed
+// may have left it broken
+func (m *Manager) Release(host string, client *cryptossh.Client, failed bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.Keep || failed || m.clients[host] != nil {
+		client.Close()
+		return
+	}
+	m.clients[host] = client
+}
+
+// KeepAlive checks the kept connections every interval until Close
+// and closes the ones that no longer answer
+func (m *Manager) KeepAlive(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-m.stop:
+				return
+			case <-ticker.C:
+			}
+			m.mu.Lock()
+			clients := make(map[string]*cryptossh.Client, len(m.clients))
+			for host, client := range m.clients {
+				clients[host] = client
+			}
+			m.mu.Unlock()
+			for host, client := range clients {
+				if alive(client) {
+					continue
+				}
+				slog.Info("dropping dead connection", "host", host, "phase", "keepalive")
+				m.mu.Lock()
+				if m.clients[host] == client {
+					delete(m.clients, host)
+				}
+				m.mu.Unlock()
+				client.Close()
+			}
+		}
+	}()
+}
+
+// Close stops the keepalive and closes every kept connection
+func (m *Manager) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	select {
+	case <-m.stop:
+	default:
+		close(m.stop)
+	}
+	for host, client := range m.clients {
+		client.Close()
+		delete(m.clients, host)
+	}
+	return nil
+}
+
+// dial logs in with both the password and keyboard-interactive in one
+// handshake, the method that worked for this host last time goes first.
+// The jump hosts of the route are closed together with the connection
+func (m *Manager) dial(ctx context.Context, target Target) (*cryptossh.Client, error) {
+	host := target.Host
+	dial, jumps, err := m.route(ctx, target.Route)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	remembered := m.methods[host]
+	m.mu.Unlock()
+
+	var tried string
+	password := cryptossh.PasswordCallback(func() (string, error) {
+		tried = methodPassword
+		return m.Password, nil
+	})
+	interactive := cryptossh.KeyboardInteractive(func(user, instruction string, questions []string, echos []bool) ([]string, error) {
+		tried = methodKeyboardInteractive
+		answers := make([]string, len(questions))
+		for i := range answers {
+			answers[i] = m.Password
+		}
+		return answers, nil
+	})
+	auth := []cryptossh.AuthMethod{password, interactive}
+	if remembered == methodKeyboardInteractive {
+		auth = []cryptossh.AuthMethod{interactive, password}
+	}
+
+	client, err := connect(ctx, dial, m.User, target, auth)
+	if err != nil {
+		closeClients(jumps)
+		return nil, err
+	}
+	if len(jumps) > 0 {
+		go func() {
+			client.Wait()
+			closeClients(jumps)
+		}()
+	}
+	m.mu.Lock()
+	m.methods[host] = tried
+	m.mu.Unlock()
+	slog.Debug("connected", "host", host, "phase", "connect", "auth", tried)
+	return client, nil
+}
+
+// alive sends an openssh keepalive, servers that do not know it still
+// answer with a failure, so only an error or no answer means dead
+func alive(client *cryptossh.Client) bool {
+	answered := make(chan error, 1)
+	go func() {
+		_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+		answered <- err
+	}()
+	select {
+	case err := <-answered:
+		return err == nil
+	case <-time.After(keepAliveTimeout):
+		return false
+	}
+}
@@ -0,0 +1,125 @@
+package ssh
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	cryptossh "golang.org/x/crypto/ssh"
+
+	"dataCollection/model"
+)
+
+// Target struct which contains everything
+// needed to reach and log in to one array
+type Target struct {
+	Host    string
+	Route   *model.Route
+	Options *model.SSHOptions
+}
+
+// TargetOf is the target of an inventory array
+func TargetOf(array model.Array) Target {
+	return Target{Host: array.Ip, Route: array.Route, Options: array.SSH}
+}
+
+// Algorithms are the names the ssh library implements per setting,
+// the legacy ones are only used when an array lists them
+var Algorithms = map[string][]string{
+	"kex": {
+		"curve25519-sha256@libssh.org", "ecdh-sha2-nistp256", "ecdh-sha2-nistp384", "ecdh-sha2-nistp521",
+		"diffie-hellman-group14-sha1", "diffie-hellman-group1-sha1",
+		"diffie-hellman-group-exchange-sha256", "diffie-hellman-group-exchange-sha1",
+	},
+	"ciphers": {
+		"aes128-gcm@openssh.com", "chacha20-poly1305@openssh.com", "aes128-ctr", "aes192-ctr", "aes256-ctr",
+		"aes128-cbc", "3des-cbc", "arcfour256", "arcfour128", "arcfour",
+	},
+	"macs": {
+		"hmac-sha2-256-etm@openssh.com", "hmac-sha2-256", "hmac-sha1", "hmac-sha1-96",
+	},
+	"host_key_algorithms": {
+		cryptossh.KeyAlgoED25519, cryptossh.KeyAlgoECDSA256, cryptossh.KeyAlgoECDSA384, cryptossh.KeyAlgoECDSA521,
+		cryptossh.KeyAlgoRSA, cryptossh.KeyAlgoDSA,
+		cryptossh.CertAlgoED25519v01, cryptossh.CertAlgoECDSA256v01, cryptossh.CertAlgoECDSA384v01,
+		cryptossh.CertAlgoECDSA521v01, cryptossh.CertAlgoRSAv01, cryptossh.CertAlgoDSAv01,
+	},
+}
+
+// CheckOptions returns a description of every problem found in the ssh settings of an array
+func CheckOptions(host string, options model.SSHOptions) (problems []string) {
+	if options.Port != 0 {
+		if options.Port < 1 || options.Port > 65535 {
+			problems = append(problems, "ssh port "+strconv.Itoa(options.Port)+" out of range")
+		}
+		if _, _, err := net.SplitHostPort(host); err == nil {
+			problems = append(problems, "ssh port set while ip "+host+" already has one")
+		}
+	}
+	lists := map[string][]string{
+		"kex":                 options.KeyExchanges,
+		"ciphers":             options.Ciphers,
+		"macs":                options.MACs,
+		"host_key_algorithms": options.HostKeyAlgorithms,
+	}
+	for _, setting := range []string{"kex", "ciphers", "macs", "host_key_algorithms"} {
+		for _, name := range lists[setting] {
+			if !contains(Algorithms[setting], name) {
+				problems = append(problems, "ssh "+setting+" "+name+" is not supported")
+			}
+		}
+	}
+	if options.DialTimeout != "" {
+		if timeout, err := time.ParseDuration(options.DialTimeout); err != nil || timeout <= 0 {
+			problems = append(problems, "ssh dial_timeout \""+options.DialTimeout+"\" is not a positive duration")
+		}
+	}
+	if options.ClientVersion != "" && !strings.HasPrefix(options.ClientVersion, "SSH-2.0-") {
+		problems = append(problems, "ssh client_version has to start with SSH-2.0-")
+	}
+	return problems
+}
+
+// address is host:port of the target, the port of the
+// ip comes first, then the ssh port setting, then 22
+func (t Target) address() string {
+	if t.Options != nil && t.Options.Port != 0 {
+		if _, _, err := net.SplitHostPort(t.Host); err != nil {
+			return net.JoinHostPort(t.Host, strconv.Itoa(t.Options.Port))
+		}
+	}
+	return Address(t.Host)
+}
+
+// dialTimeout is the timeout of the target, dialTimeout when not set or invalid
+func (t Target) dialTimeout() time.Duration {
+	if t.Options != nil && t.Options.DialTimeout != "" {
+		if timeout, err := time.ParseDuration(t.Options.DialTimeout); err == nil && timeout > 0 {
+			return timeout
+		}
+	}
+	return dialTimeout
+}
+
+// apply puts the algorithm and version settings of the target into config
+func (t Target) apply(config *cryptossh.ClientConfig) {
+	config.Timeout = t.dialTimeout()
+	if t.Options == nil {
+		return
+	}
+	config.KeyExchanges = t.Options.KeyExchanges
+	config.Ciphers = t.Options.Ciphers
+	config.MACs = t.Options.MACs
+	config.HostKeyAlgorithms = t.Options.HostKeyAlgorithms
+	config.ClientVersion = t.Options.ClientVersion
+}
+
+func contains(list []string, name string) bool {
+	for _, item := range list {
+		if item == name {
+			return true
+		}
+	}
+	return false
+}
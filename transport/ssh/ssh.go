@@ -0,0 +1,182 @@
+// Package ssh runs the array commands over ssh with the password, falling
+// back to keyboard-interactive for arrays that only offer that. Arrays can
+// be reached directly, through a socks5 proxy or through ssh jump hosts.
+package ssh
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	cryptossh "golang.org/x/crypto/ssh"
+
+	"dataCollection/model"
+)
+
+// dialTimeout bounds the tcp connect and the ssh handshake of one hop
+// unless the ssh settings of the array give another
+const dialTimeout = 10 * time.Second
+
+// dialFunc opens the connection an ssh handshake runs over
+type dialFunc func(ctx context.Context, address string) (net.Conn, error)
+
+// Dial logs in once with the password and keyboard-interactive, which some
+// arrays require for the same password, without remembering the method
+func Dial(ctx context.Context, user, password string, target Target) (*cryptossh.Client, error) {
+	return NewManager(user, password, false).dial(ctx, target)
+}
+
+// Address adds the ssh port unless the inventory ip already has one
+func Address(host string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	return net.JoinHostPort(host, "22")
+}
+
+func directDial(ctx context.Context, address string) (net.Conn, error) {
+	dialer := net.Dialer{Timeout: dialTimeout}
+	return dialer.DialContext(ctx, "tcp", address)
+}
+
+// throughClient opens connections as direct-tcpip channels of a jump host
+func throughClient(client *cryptossh.Client) dialFunc {
+	return func(ctx context.Context, address string) (net.Conn, error) {
+		type result struct {
+			conn net.Conn
+			err  error
+		}
+		done := make(chan result, 1)
+		go func() {
+			conn, err := client.Dial("tcp", address)
+			done <- result{conn, err}
+		}()
+		select {
+		case r := <-done:
+			return r.conn, r.err
+		case <-ctx.Done():
+			go func() {
+				if r := <-done; r.conn != nil {
+					r.conn.Close()
+				}
+			}()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// route connects the socks5 proxy and jump hosts of route in order and returns
+// how to reach the array from the last of them. The jump clients have to be
+// closed once the array connection is done with
+func (m *Manager) route(ctx context.Context, route *model.Route) (dialFunc, []*cryptossh.Client, error) {
+	dial := dialFunc(directDial)
+	if route == nil {
+		return dial, nil, nil
+	}
+	if route.SOCKS5 != "" {
+		proxy, err := parseSOCKS5(route.SOCKS5)
+		if err != nil {
+			return nil, nil, err
+		}
+		dial = proxy.dial
+	}
+	var jumps []*cryptossh.Client
+	for _, hop := range route.Jump {
+		user := hop.User
+		if user == "" {
+			user = m.User
+		}
+		auth, err := m.jumpAuth(hop)
+		if err == nil {
+			var client *cryptossh.Client
+			client, err = connect(ctx, dial, user, Target{Host: hop.Host}, auth)
+			if err == nil {
+				jumps = append(jumps, client)
+				dial = throughClient(client)
+				continue
+			}
+		}
+		closeClients(jumps)
+		return nil, nil, fmt.Errorf("jump host %s: %w", hop.Host, err)
+	}
+	return dial, jumps, nil
+}
+
+// jumpAuth is the login of a jump host, its key file and password,
+// the array password when the hop has neither
+func (m *Manager) jumpAuth(hop model.JumpHost) ([]cryptossh.AuthMethod, error) {
+	var auth []cryptossh.AuthMethod
+	if hop.KeyFile != "" {
+		key, err := os.ReadFile(hop.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		signer, err := cryptossh.ParsePrivateKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", hop.KeyFile, err)
+		}
+		auth = append(auth, cryptossh.PublicKeys(signer))
+	}
+	password := hop.Password
+	if hop.PasswordEnv != "" {
+		password = os.Getenv(hop.PasswordEnv)
+	}
+	if password == "" && hop.KeyFile == "" {
+		password = m.Password
+	}
+	if password != "" {
+		auth = append(auth, cryptossh.Password(password), keyboardInteractive(password))
+	}
+	return auth, nil
+}
+
+func keyboardInteractive(password string) cryptossh.AuthMethod {
+	return cryptossh.KeyboardInteractive(func(user, instruction string, questions []string, echos []bool) ([]string, error) {
+		answers := make([]string, len(questions))
+		for i := range answers {
+			answers[i] = password
+		}
+		return answers, nil
+	})
+}
+
+func closeClients(clients []*cryptossh.Client) {
+	for i := len(clients) - 1; i >= 0; i-- {
+		clients[i].Close()
+	}
+}
+
+func connect(ctx context.Context, dial dialFunc, user string, target Target, auth []cryptossh.AuthMethod) (*cryptossh.Client, error) {
+	sshConfig := &cryptossh.ClientConfig{
+		User:            user,
+		Auth:            auth,
+		HostKeyCallback: cryptossh.InsecureIgnoreHostKey(),
+	}
+	target.apply(sshConfig)
+	address := target.address()
+	deadline := time.Now().Add(sshConfig.Timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	dialCtx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+	conn, err := dial(dialCtx, address)
+	if err != nil {
+		return nil, err
+	}
+	// the handshake has no context, a deadline stops it when ctx ends first.
+	// Channels of a jump host have no deadlines, those are closed instead
+	if err := conn.SetDeadline(deadline); err != nil {
+		timer := time.AfterFunc(time.Until(deadline), func() { conn.Close() })
+		defer timer.Stop()
+	}
+	clientConn, channels, requests, err := cryptossh.NewClientConn(conn, address, sshConfig)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return cryptossh.NewClient(clientConn, channels, requests), nil
+}
@@ -0,0 +1,74 @@
+// Package transport defines how commands reach an array and replays
+// recorded output in place of a live array.
+package transport
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Runner runs a cli command on an array, either over ssh or by replaying
+// output recorded earlier. Stdout is the data, stderr is kept apart so
+// cli error messages are never parsed as data
+type Runner interface {
+	Run(ctx context.Context, command string) (stdout, stderr []byte, err error)
+}
+
+var (
+	// ErrTimeout is returned for a command that did not finish in time
+	ErrTimeout = errors.New("command timed out")
+	// ErrOutputLimit is returned for a command that wrote more than allowed
+	ErrOutputLimit = errors.New("command output over limit")
+	// ErrUnauthorized is returned when an api refuses the credentials
+	ErrUnauthorized = errors.New("unable to authenticate")
+)
+
+// CommandError is a command that ran and exited with a non-zero status,
+// Stderr holds what the cli said about it
+type CommandError struct {
+	Command    string
+	ExitStatus int
+	Stderr     string
+}
+
+func (e *CommandError) Error() string {
+	message := e.Command + ": exit status " + strconv.Itoa(e.ExitStatus)
+	if e.Stderr != "" {
+		message += ": " + e.Stderr
+	}
+	return message
+}
+
+// Replay answers commands from the files of a fixture directory
+type Replay struct {
+	Dir string
+}
+
+func (r Replay) Run(ctx context.Context, command string) ([]byte, []byte, error) {
+	stdout, err := ioutil.ReadFile(filepath.Join(r.Dir, CommandFile(command)))
+	return stdout, nil, err
+}
+
+// CommandFile names the fixture file of a command after its words without flags
+// and their values, "lsmdiskgrp -bytes -delim ," is lsmdiskgrp.txt and
+// "storage aggregate show -fields size" is storage_aggregate_show.txt
+func CommandFile(command string) string {
+	var words []string
+	flag := false
+	for _, field := range strings.Fields(command) {
+		if strings.HasPrefix(field, "-") {
+			flag = true
+			continue
+		}
+		if flag {
+			flag = false
+			continue
+		}
+		words = append(words, field)
+	}
+	return strings.Join(words, "_") + ".txt"
+}
@@ -0,0 +1,100 @@
+package vendors
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+// RESTPaths are the api paths answering the commands of the models that can
+// be collected over REST, the parsers read their json in place of the cli output
+var RESTPaths = map[string]map[string]string{
+	"ontap": {
+		Commands["ontap"].Data:     "/api/storage/aggregates?fields=name,uuid,state,space.block_storage.size,space.block_storage.available,space.block_storage.used",
+		Commands["ontap"].Firmware: "/api/cluster?fields=name,uuid,location,version",
+	},
+}
+
+// ontapAggregates is the part of /api/storage/aggregates that becomes pools
+type ontapAggregates struct {
+	Records []struct {
+		UUID  string `json:"uuid"`
+		Name  string `json:"name"`
+		State string `json:"state"`
+		Space struct {
+			BlockStorage struct {
+				Size      float64 `json:"size"`
+				Available float64 `json:"available"`
+				Used      float64 `json:"used"`
+			} `json:"block_storage"`
+		} `json:"space"`
+	} `json:"records"`
+	// NumRecords counts the records of the answer, Next links to the rest of a
+	// listing longer than one page
+	NumRecords *int `json:"num_records"`
+	Links      struct {
+		Next struct {
+			Href string `json:"href"`
+		} `json:"next"`
+	} `json:"_links"`
+}
+
+// isJSON tells the output of a REST api apart from cli output
+func isJSON(output []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(output), []byte("{"))
+}
+
+var ontapRelease = regexp.MustCompile(`NetApp Release ([^:\s]+)`)
+
+// ONTAPSystemValues turns the output of version, or the json of /api/cluster,
+// into a map with the version line and on REST the cluster name, uuid and location
+func ONTAPSystemValues(inputFw []byte) map[string]string {
+	values := make(map[string]string)
+	if isJSON(inputFw) {
+		var cluster struct {
+			Name     string `json:"name"`
+			UUID     string `json:"uuid"`
+			Location string `json:"location"`
+			Version  struct {
+				Full string `json:"full"`
+			} `json:"version"`
+		}
+		if json.Unmarshal(inputFw, &cluster) == nil {
+			values["name"] = cluster.Name
+			values["uuid"] = cluster.UUID
+			values["location"] = cluster.Location
+			values["version"] = cluster.Version.Full
+		}
+	} else {
+		for _, line := range strings.Split(string(inputFw), "\n") {
+			if strings.Contains(line, "NetApp Release") {
+				values["version"] = strings.TrimSpace(line)
+				break
+			}
+		}
+	}
+	if match := ontapRelease.FindStringSubmatch(values["version"]); match != nil {
+		values["release"] = match[1]
+	}
+	return values
+}
+
+// ontapTable finds the header of a storage aggregate show table above its line of
+// dashes and the position of every column, the rows start after the dashes
+func ontapTable(lines []string) (map[string]int, int) {
+	for i, line := range lines {
+		if i == 0 || !strings.HasPrefix(strings.TrimSpace(line), "---") {
+			continue
+		}
+		columns := make(map[string]int)
+		for index, name := range strings.Fields(lines[i-1]) {
+			columns[name] = index
+		}
+		return columns, i + 1
+	}
+	return nil, -1
+}
+
+// ontapFooter matches the lines ONTAP prints below a table
+var ontapFooter = regexp.MustCompile(`^\d+ entr(y was|ies were) displayed\.$`)
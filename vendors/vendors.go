@@ -0,0 +1,437 @@
+// Package vendors knows the commands of every supported array model
+// and parses their output into pools and systems.
+package vendors
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"dataCollection/model"
+)
+
+// Commands are the commands run on an array of each model,
+// data lists the pools and firmware describes the system
+var Commands = map[string]struct {
+	Data     string
+	Firmware string
+}{
+	"ibm":    {Data: "lsmdiskgrp -bytes -delim ,", Firmware: "lssystem -delim ,"},
+	"huawei": {Data: "show storage_pool general", Firmware: "show system general"},
+	"ontap":  {Data: "storage aggregate show -fields size,availsize,usedsize,state", Firmware: "version"},
+}
+
+// ReadOnly are the command patterns every model may run, word by word as in
+// path.Match. A command may have more words than its pattern, anything that
+// matches no pattern is refused before it reaches the array
+var ReadOnly = map[string][]string{
+	"ibm":    {"ls*", "svcinfo ls*"},
+	"huawei": {"show *"},
+	"ontap":  {"storage aggregate show", "version"},
+}
+
+// shellCharacters could chain or redirect a second command behind a listed one
+const shellCharacters = "|;&<>`$\\\"'(){}\n\r"
+
+// Allowed checks a command against the read-only allowlist of its model
+func Allowed(arrayModel, command string) error {
+	if strings.ContainsAny(command, shellCharacters) {
+		return fmt.Errorf("%q: shell characters are not allowed", command)
+	}
+	words := strings.Fields(command)
+	for _, pattern := range ReadOnly[arrayModel] {
+		patternWords := strings.Fields(pattern)
+		if len(words) < len(patternWords) {
+			continue
+		}
+		matched := true
+		for i, patternWord := range patternWords {
+			if ok, _ := path.Match(patternWord, words[i]); !ok {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return nil
+		}
+	}
+	return fmt.Errorf("%q is not a read-only %s command", command, arrayModel)
+}
+
+// ParsePools turns the pool listing of an array into pools. Rows that cannot be
+// parsed are skipped and reported in err, so one odd row does not lose the others
+func ParsePools(inputData []byte, inputFw []byte, arrayModel, array, site, type_s, client_s string) (output model.Pools, err error) {
+	splitInputData := strings.Split(strings.ReplaceAll(string(inputData), "\r", ""), "\n")
+	addPool := func(pool model.Pool) {
+		pool.ArrayName = array
+		pool.Site = site
+		pool.Type = type_s
+		pool.Client = client_s
+		if pool.PoolCapacity > 0 {
+			pool.PoolCapacityPCT = pool.PoolCapacityUsed / pool.PoolCapacity
+		}
+		output.Pools = append(output.Pools, pool)
+	}
+	rowError := func(line int, rowErr error) {
+		if err == nil {
+			err = fmt.Errorf("ParsePools: %s: line %d: %w", array, line+1, rowErr)
+		}
+	}
+	switch arrayModel {
+	case "ibm":
+		firmware := FirstField(IBMSystemValues(inputFw)["code_level"])
+		columns, headerLine := ibmHeader(splitInputData)
+		if headerLine < 0 {
+			if strings.TrimSpace(string(inputData)) != "" {
+				err = fmt.Errorf("ParsePools: %s: no lsmdiskgrp header in output", array)
+			}
+			return output, err
+		}
+		for i := headerLine + 1; i < len(splitInputData); i++ {
+			line := strings.TrimSpace(splitInputData[i])
+			if line == "" {
+				continue
+			}
+			lineSplit := strings.Split(line, ",")
+			if len(lineSplit) < len(columns) {
+				rowError(i, fmt.Errorf("%d columns, header has %d", len(lineSplit), len(columns)))
+				continue
+			}
+			column := func(name string) string {
+				return strings.TrimSpace(lineSplit[columns[name]])
+			}
+			var pool model.Pool
+			var parseErr error
+			number := func(name string) float64 {
+				value, err := ParseNumber(column(name))
+				if err != nil && parseErr == nil {
+					parseErr = fmt.Errorf("%s: %w", name, err)
+				}
+				return value
+			}
+			pool.Id = column("id")
+			pool.PoolName = column("name")
+			pool.Health = column("status")
+			pool.RunningStatus = column("status")
+			pool.PoolCapacity = number("capacity")
+			pool.PoolCapacityUsed = number("used_capacity")
+			pool.PoolCapacityFree = number("free_capacity")
+			// older code levels have no warning column, the pool then has no threshold
+			if _, ok := columns["warning"]; ok {
+				pool.WarningPCT = number("warning")
+			}
+			if parseErr != nil {
+				rowError(i, parseErr)
+				continue
+			}
+			pool.Firmware = firmware
+			addPool(pool)
+		}
+
+	case "huawei":
+		values := HuaweiSystemValues(inputFw)
+		firmware := values["Product Version"] + ", " + values["Patch Version"]
+		var warning float64
+		if values["High Water Level(%)"] != "" {
+			warning, err = ParseNumber(values["High Water Level(%)"])
+			if err != nil {
+				err = fmt.Errorf("ParsePools: %s: High Water Level(%%): %w", array, err)
+			}
+		}
+		// the rows follow the line of dashes under the header
+		start := -1
+		for i, line := range splitInputData {
+			if strings.HasPrefix(strings.TrimSpace(line), "--") {
+				start = i + 1
+				break
+			}
+		}
+		if start < 0 {
+			if strings.TrimSpace(string(inputData)) != "" && err == nil {
+				err = fmt.Errorf("ParsePools: %s: no storage pool table in output", array)
+			}
+			return output, err
+		}
+		re_leadclose_whtsp := regexp.MustCompile(`^[\s\p{Zs}]+|[\s\p{Zs}]+$`)
+		re_inside_whtsp := regexp.MustCompile(`[\s\p{Zs}]{2,}`)
+		for i := start; i < len(splitInputData); i++ {
+			line := strings.ReplaceAll(splitInputData[i], "	", "")
+			line = re_leadclose_whtsp.ReplaceAllString(line, "")
+			line = re_inside_whtsp.ReplaceAllString(line, " ")
+			if line == "" {
+				continue
+			}
+			splitLine := strings.Split(line, " ")
+			if len(splitLine) < 7 {
+				rowError(i, fmt.Errorf("%d columns, expected at least 7", len(splitLine)))
+				continue
+			}
+			var pool model.Pool
+			var parseErr error
+			pool.Id = splitLine[0]
+			pool.PoolName = splitLine[1]
+			pool.Health = splitLine[3]
+			pool.RunningStatus = splitLine[4]
+			pool.PoolCapacity, parseErr = ParseCapacity(splitLine[5])
+			if parseErr == nil {
+				pool.PoolCapacityFree, parseErr = ParseCapacity(splitLine[6])
+			}
+			if parseErr != nil {
+				rowError(i, parseErr)
+				continue
+			}
+			pool.PoolCapacityUsed = pool.PoolCapacity - pool.PoolCapacityFree
+			pool.WarningPCT = warning
+			pool.Firmware = firmware
+			addPool(pool)
+		}
+
+	case "ontap":
+		firmware := ONTAPSystemValues(inputFw)["release"]
+		// aggregates are keyed by name, which cli and REST both have, so switching does not churn the pools
+		if isJSON(inputData) {
+			var aggregates ontapAggregates
+			if jsonErr := json.Unmarshal(inputData, &aggregates); jsonErr != nil {
+				return output, fmt.Errorf("ParsePools: %s: %w", array, jsonErr)
+			}
+			// pools missing from a partial listing would be taken for removed
+			if aggregates.Links.Next.Href != "" {
+				return output, fmt.Errorf("ParsePools: %s: listing continues at %s", array, aggregates.Links.Next.Href)
+			}
+			if aggregates.NumRecords != nil && *aggregates.NumRecords != len(aggregates.Records) {
+				return output, fmt.Errorf("ParsePools: %s: %d of %d records in listing", array, len(aggregates.Records), *aggregates.NumRecords)
+			}
+			for _, record := range aggregates.Records {
+				var pool model.Pool
+				pool.Id = record.Name
+				pool.PoolName = record.Name
+				pool.Health = record.State
+				pool.RunningStatus = record.State
+				pool.PoolCapacity = record.Space.BlockStorage.Size
+				pool.PoolCapacityFree = record.Space.BlockStorage.Available
+				pool.PoolCapacityUsed = record.Space.BlockStorage.Used
+				pool.Firmware = firmware
+				addPool(pool)
+			}
+			return output, err
+		}
+		columns, start := ontapTable(splitInputData)
+		if start < 0 {
+			if strings.TrimSpace(string(inputData)) != "" && !strings.Contains(string(inputData), "There are no entries") {
+				err = fmt.Errorf("ParsePools: %s: no storage aggregate table in output", array)
+			}
+			return output, err
+		}
+		for _, name := range []string{"aggregate", "size", "availsize", "usedsize", "state"} {
+			if _, ok := columns[name]; !ok {
+				return output, fmt.Errorf("ParsePools: %s: no %s column in storage aggregate table", array, name)
+			}
+		}
+		for i := start; i < len(splitInputData); i++ {
+			line := strings.TrimSpace(splitInputData[i])
+			if line == "" || ontapFooter.MatchString(line) {
+				continue
+			}
+			lineSplit := strings.Fields(line)
+			if len(lineSplit) < len(columns) {
+				rowError(i, fmt.Errorf("%d columns, header has %d", len(lineSplit), len(columns)))
+				continue
+			}
+			var pool model.Pool
+			var parseErr error
+			// an offline aggregate shows - for its sizes and is kept with zero capacity
+			capacity := func(name string) float64 {
+				value := lineSplit[columns[name]]
+				if value == "-" {
+					return 0
+				}
+				number, err := ParseCapacity(value)
+				if err != nil && parseErr == nil {
+					parseErr = fmt.Errorf("%s: %w", name, err)
+				}
+				return number
+			}
+			pool.Id = lineSplit[columns["aggregate"]]
+			pool.PoolName = pool.Id
+			pool.Health = lineSplit[columns["state"]]
+			pool.RunningStatus = pool.Health
+			pool.PoolCapacity = capacity("size")
+			pool.PoolCapacityFree = capacity("availsize")
+			pool.PoolCapacityUsed = capacity("usedsize")
+			if parseErr != nil {
+				rowError(i, parseErr)
+				continue
+			}
+			pool.Firmware = firmware
+			addPool(pool)
+		}
+
+	default:
+		err = fmt.Errorf("ParsePools: %s: unsupported model %s", array, arrayModel)
+	}
+
+	return output, err
+}
+
+// ibmHeader finds the header of lsmdiskgrp -delim , and the position of every column,
+// warning is optional
+func ibmHeader(lines []string) (map[string]int, int) {
+	for i, line := range lines {
+		columns := make(map[string]int)
+		for index, name := range strings.Split(strings.TrimSpace(line), ",") {
+			columns[name] = index
+		}
+		found := true
+		for _, name := range []string{"id", "name", "status", "capacity", "free_capacity", "used_capacity"} {
+			if _, ok := columns[name]; !ok {
+				found = false
+				break
+			}
+		}
+		if found {
+			return columns, i
+		}
+	}
+	return nil, -1
+}
+
+func ParseSystem(inputFw []byte, arrayModel, array, site, client_s string) (output model.System, err error) {
+	output.ArrayName = array
+	output.Site = site
+	output.Client = client_s
+	output.CollectedAt = time.Now()
+	field := func(name, value string, parse func(string) (float64, error)) float64 {
+		if value == "" {
+			return 0
+		}
+		number, parseErr := parse(value)
+		if parseErr != nil && err == nil {
+			err = fmt.Errorf("ParseSystem: %s: %s: %w", array, name, parseErr)
+		}
+		return number
+	}
+	switch arrayModel {
+	case "ibm":
+		values := IBMSystemValues(inputFw)
+		output.Vendor = "IBM"
+		output.Model = values["product_name"]
+		output.Firmware = FirstField(values["code_level"])
+		output.Location = values["location"]
+		// lssystem has no serial number, the cluster id is the closest unique identifier
+		output.Serial = values["id"]
+		output.TotalCapacity = field("total_mdisk_capacity", values["total_mdisk_capacity"], ParseCapacity)
+		// lssystem reports no health of the system, Health and RunningStatus stay empty
+		// and the health of IBM arrays comes from their pools
+
+	case "huawei":
+		values := HuaweiSystemValues(inputFw)
+		output.Vendor = "Huawei"
+		output.Model = values["Product Model"]
+		output.Serial = values["SN"]
+		output.Firmware = values["Product Version"]
+		output.Patch = values["Patch Version"]
+		output.Location = values["Location"]
+		output.WWN = values["WWN"]
+		output.Health = values["Health Status"]
+		output.RunningStatus = values["Running Status"]
+		output.TotalCapacity = field("Total Capacity", values["Total Capacity"], ParseCapacity)
+		output.HighWaterLevel = field("High Water Level(%)", values["High Water Level(%)"], ParseNumber)
+		output.LowWaterLevel = field("Low Water Level(%)", values["Low Water Level(%)"], ParseNumber)
+
+	case "ontap":
+		values := ONTAPSystemValues(inputFw)
+		output.Vendor = "NetApp"
+		output.Model = "ONTAP"
+		output.Firmware = values["release"]
+		// the cli version has no serial, the REST cluster uuid is the closest unique identifier
+		output.Serial = values["uuid"]
+		output.Location = values["location"]
+
+	default:
+		return output, fmt.Errorf("ParseSystem: %s: unsupported model %s", array, arrayModel)
+	}
+	if err == nil && output.Firmware == "" {
+		err = fmt.Errorf("ParseSystem: %s: no code level in output", array)
+	}
+
+	return output, err
+}
+
+// IBMSystemValues turns "key,value" lines from lssystem -delim , into a map
+func IBMSystemValues(inputFw []byte) map[string]string {
+	values := make(map[string]string)
+	for _, line := range strings.Split(string(inputFw), "\n") {
+		keyValue := strings.SplitN(strings.TrimSpace(line), ",", 2)
+		if len(keyValue) == 2 {
+			values[keyValue[0]] = strings.TrimSpace(keyValue[1])
+		}
+	}
+	return values
+}
+
+// HuaweiSystemValues turns "Key : Value" lines from show system general into a map
+func HuaweiSystemValues(inputFw []byte) map[string]string {
+	values := make(map[string]string)
+	for _, line := range strings.Split(string(inputFw), "\n") {
+		keyValue := strings.SplitN(line, ":", 2)
+		if len(keyValue) == 2 {
+			values[strings.TrimSpace(keyValue[0])] = strings.TrimSpace(keyValue[1])
+		}
+	}
+	return values
+}
+
+// ParseCapacity converts values like "123.410TB" to bytes
+func ParseCapacity(value string) (float64, error) {
+	units := []struct {
+		suffix     string
+		multiplier float64
+	}{
+		{"PB", 1024 * 1024 * 1024 * 1024 * 1024},
+		{"TB", 1024 * 1024 * 1024 * 1024},
+		{"GB", 1024 * 1024 * 1024},
+		{"MB", 1024 * 1024},
+		{"KB", 1024},
+		{"B", 1},
+	}
+	value = strings.TrimSpace(value)
+	for _, unit := range units {
+		if strings.HasSuffix(value, unit.suffix) {
+			capacity, err := ParseNumber(strings.TrimSuffix(value, unit.suffix))
+			return capacity * unit.multiplier, err
+		}
+	}
+	return ParseNumber(value)
+}
+
+// ParseNumber is strconv.ParseFloat without NaN and infinity, which influx does not accept
+func ParseNumber(value string) (float64, error) {
+	number, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(number) || math.IsInf(number, 0) {
+		return 0, fmt.Errorf("invalid number %q", value)
+	}
+	return number, nil
+}
+
+// FirstField returns the first word of value, "8.3.1.5 (build 150.27)" gives 8.3.1.5
+func FirstField(value string) string {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
+
+var Supported = map[string]bool{
+	"ibm":    true,
+	"huawei": true,
+	"ontap":  true,
+}
@@ -0,0 +1,229 @@
+package vendors
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"dataCollection/model"
+	"dataCollection/transport"
+)
+
+var update = flag.Bool("update", false, "write expected.json from the current parsers instead of comparing")
+
+const fixtureRoot = "../fixtures"
+
+// golden struct which contains what the parsers make of
+// one fixture directory, kept in its expected.json
+type golden struct {
+	Pools       []model.Pool `json:"pools"`
+	PoolsError  string       `json:"pools_error,omitempty"`
+	System      model.System `json:"system"`
+	SystemError string       `json:"system_error,omitempty"`
+}
+
+// fixture is the recorded output of one directory below fixtureRoot
+type fixture struct {
+	Dir   string
+	Model string
+	Data  []byte
+	Fw    []byte
+}
+
+// readFixtures finds every directory below fixtureRoot holding recorded output, the
+// model is the first path element that names a supported model
+func readFixtures(tb testing.TB) []fixture {
+	models := make(map[string]string)
+	err := filepath.Walk(fixtureRoot, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || filepath.Ext(path) != ".txt" {
+			return err
+		}
+		dir := filepath.Dir(path)
+		rel, err := filepath.Rel(fixtureRoot, dir)
+		if err != nil {
+			return err
+		}
+		for _, part := range strings.Split(filepath.ToSlash(rel), "/") {
+			if Supported[part] {
+				models[dir] = part
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	var fixtures []fixture
+	for dir, arrayModel := range models {
+		data, err := ioutil.ReadFile(filepath.Join(dir, transport.CommandFile(Commands[arrayModel].Data)))
+		if err != nil {
+			tb.Fatal(err)
+		}
+		fw, err := ioutil.ReadFile(filepath.Join(dir, transport.CommandFile(Commands[arrayModel].Firmware)))
+		if err != nil {
+			tb.Fatal(err)
+		}
+		fixtures = append(fixtures, fixture{Dir: dir, Model: arrayModel, Data: data, Fw: fw})
+	}
+	sort.Slice(fixtures, func(i, j int) bool {
+		return fixtures[i].Dir < fixtures[j].Dir
+	})
+	if len(fixtures) == 0 {
+		tb.Fatal("no fixtures in " + fixtureRoot)
+	}
+	return fixtures
+}
+
+// parseFixture runs the parsers on recorded output as CollectArray would, with
+// fixed names so the result does not depend on the inventory
+func parseFixture(inputData, inputFw []byte, arrayModel string) golden {
+	var result golden
+	pools, err := ParsePools(inputData, inputFw, arrayModel, "fixture", "site", "type", "client")
+	result.Pools = pools.Pools
+	if err != nil {
+		result.PoolsError = err.Error()
+	}
+	result.System, err = ParseSystem(inputFw, arrayModel, "fixture", "site", "client")
+	result.System.CollectedAt = time.Time{}
+	if err != nil {
+		result.SystemError = err.Error()
+	}
+	return result
+}
+
+// TestFixtures compares the parsed result of every fixture with the expected.json next
+// to it, go test ./vendors -run TestFixtures -update rewrites them after a parser change
+func TestFixtures(t *testing.T) {
+	for _, fixture := range readFixtures(t) {
+		t.Run(filepath.ToSlash(strings.TrimPrefix(fixture.Dir, fixtureRoot+string(filepath.Separator))), func(t *testing.T) {
+			byteValue, err := json.MarshalIndent(parseFixture(fixture.Data, fixture.Fw, fixture.Model), "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			byteValue = append(byteValue, '\n')
+			path := filepath.Join(fixture.Dir, "expected.json")
+			if *update {
+				if err := ioutil.WriteFile(path, byteValue, 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			expected, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err.Error() + ", run with -update to create it")
+			}
+			if !bytes.Equal(expected, byteValue) {
+				t.Error("parsed result differs from expected.json\n" + firstDifference(string(expected), string(byteValue)))
+			}
+		})
+	}
+}
+
+func firstDifference(expected, got string) string {
+	expectedLines := strings.Split(expected, "\n")
+	gotLines := strings.Split(got, "\n")
+	for i := 0; i < len(expectedLines) && i < len(gotLines); i++ {
+		if expectedLines[i] != gotLines[i] {
+			return "  line " + strconv.Itoa(i+1) + "\n  want: " + expectedLines[i] + "\n  got:  " + gotLines[i]
+		}
+	}
+	return "  want " + strconv.Itoa(len(expectedLines)) + " lines, got " + strconv.Itoa(len(gotLines))
+}
+
+func TestAllowed(t *testing.T) {
+	tests := []struct {
+		model   string
+		command string
+		allowed bool
+	}{
+		{"ibm", "lsmdiskgrp -bytes -delim ,", true},
+		{"ibm", "svcinfo lssystem -delim ,", true},
+		{"ibm", "svctask rmmdiskgrp -force 0", false},
+		{"ibm", "svcinfo", false},
+		{"ibm", "lssystem\nchsystem -name x", false},
+		{"ibm", "lssystem `chsystem -name x`", false},
+		{"ibm", "lssystem $(chsystem -name x)", false},
+		{"ibm", "lssystem ${IFS}", false},
+		{"ibm", "lssystem\rchsystem", false},
+		{"ibm", "lssystem > /tmp/x", false},
+		{"ibm", "lssystem -delim \\,", false},
+		{"ibm", "", false},
+		{"huawei", "show system general", true},
+		{"huawei", "show", false},
+		{"huawei", "change user_mgt offline_user user_name=admin", false},
+		{"ontap", "storage aggregate show -fields size,availsize,usedsize,state", true},
+		{"ontap", "storage aggregate", false},
+		{"ontap", "storage aggregate delete -aggregate aggr1", false},
+		{"ontap", "storage aggregate showx", false},
+		{"ontap", "version", true},
+		{"ontap", "volume show", false},
+		{"ontap", "versions", false},
+		{"unknown", "version", false},
+	}
+	for _, test := range tests {
+		err := Allowed(test.model, test.command)
+		if (err == nil) != test.allowed {
+			t.Errorf("Allowed(%s, %q) = %v, want allowed %v", test.model, test.command, err, test.allowed)
+		}
+	}
+}
+
+// fuzzModels are the models the fuzz targets pick from with their model byte
+func fuzzModels() []string {
+	var models []string
+	for arrayModel := range Supported {
+		models = append(models, arrayModel)
+	}
+	sort.Strings(models)
+	return models
+}
+
+func fuzzModelIndex(arrayModel string) uint8 {
+	return uint8(sort.SearchStrings(fuzzModels(), arrayModel))
+}
+
+// checkFinite fails on the NaN and infinite values influx rejects
+func checkFinite(t *testing.T, what string, values ...float64) {
+	for _, value := range values {
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			t.Fatalf("%s has a NaN or infinite value", what)
+		}
+	}
+}
+
+// FuzzParsePools feeds the pool parsers mutations of the recorded output, seeded with
+// every fixture. They must return an error for what they cannot read, never panic
+func FuzzParsePools(f *testing.F) {
+	for _, fixture := range readFixtures(f) {
+		f.Add(fixture.Data, fixture.Fw, fuzzModelIndex(fixture.Model))
+	}
+	models := fuzzModels()
+	f.Fuzz(func(t *testing.T, inputData, inputFw []byte, index uint8) {
+		pools, _ := ParsePools(inputData, inputFw, models[int(index)%len(models)], "fuzz", "site", "type", "client")
+		for _, pool := range pools.Pools {
+			checkFinite(t, "pool "+pool.Id, pool.PoolCapacity, pool.PoolCapacityFree, pool.PoolCapacityUsed, pool.PoolCapacityPCT, pool.WarningPCT)
+		}
+	})
+}
+
+// FuzzParseSystem does the same for the system parsers
+func FuzzParseSystem(f *testing.F) {
+	for _, fixture := range readFixtures(f) {
+		f.Add(fixture.Fw, fuzzModelIndex(fixture.Model))
+	}
+	models := fuzzModels()
+	f.Fuzz(func(t *testing.T, inputFw []byte, index uint8) {
+		system, _ := ParseSystem(inputFw, models[int(index)%len(models)], "fuzz", "site", "client")
+		checkFinite(t, "system", system.TotalCapacity, system.HighWaterLevel, system.LowWaterLevel)
+	})
+}